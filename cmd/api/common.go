@@ -125,6 +125,31 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
+// readBody() reads the raw request body for handlers which don't decode it straight
+// into a struct. The body is limited to 1MB, just like in readJSON().
+func (app *application) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return nil, err
+		}
+	}
+
+	if len(body) == 0 {
+		return nil, errors.New("request body must not be empty")
+	}
+
+	return body, nil
+}
+
 // Read snip ID URL param.
 func (app *application) readIDParam(r *http.Request) (int64, error) {
 	// PathValue() is new for Go 1.22 and allows us to read URL params.
@@ -137,6 +162,16 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// Read snip version URL param.
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	version, err := strconv.ParseInt(r.PathValue("version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+
+	return int32(version), nil
+}
+
 // setupLogger configures the logging output based on the useLog flag.
 func setupLogger(useLog bool) io.Writer {
 	var logWriter io.Writer
@@ -212,3 +247,22 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	// Otherwise, return the converted integer value.
 	return i
 }
+
+// background() runs fn in a new goroutine which the server waits for when it shuts
+// down. A panic in a background goroutine would take the whole server down, as it
+// isn't covered by the gracefulRecovery() middleware, so it's recovered and logged.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
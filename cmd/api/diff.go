@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/diff"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// diffSnipHandler compares two versions of a snip. The content is compared line by line
+// and returned as a unified diff, structured hunks, or side-by-side rows depending on
+// the format parameter. Title and tag changes are always included.
+func (app *application) diffSnipHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Fetch the snip first, so that an unknown snip is a 404 and so we know the
+	// current version to use as the default for the "to" parameter.
+	snip, err := app.models.Snips.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	// By default compare the current version with the one before it. A snip which has
+	// never been updated is compared with itself, giving an empty diff.
+	to := app.readInt(qs, "to", int(snip.Version), v)
+	from := app.readInt(qs, "from", max(to-1, 1), v)
+	contextLines := app.readInt(qs, "context", 3, v)
+	format := app.readString(qs, "format", "unified")
+
+	v.Check(from > 0, "from", "must be greater than zero")
+	v.Check(to > 0, "to", "must be greater than zero")
+	v.Check(from <= math.MaxInt32, "from", "must not be more than 2147483647")
+	v.Check(to <= math.MaxInt32, "to", "must not be more than 2147483647")
+	v.Check(contextLines >= 0, "context", "must not be negative")
+	v.Check(contextLines <= 100, "context", "must be a maximum of 100")
+	v.Check(validator.PermittedValue(format, "unified", "hunks", "side-by-side"), "format", "must be unified, hunks or side-by-side")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Load both versions, reporting which one is missing if either can't be found.
+	versions := make(map[string]*data.Revision, 2)
+	for key, version := range map[string]int{"from": from, "to": to} {
+		revision, err := app.models.Snips.GetVersion(snip.ID, int32(version))
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError(key, "no such version for this snip")
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		versions[key] = revision
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	older, newer := versions["from"], versions["to"]
+
+	type change struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+
+	type tagChanges struct {
+		Added   []string `json:"added,omitempty"`
+		Removed []string `json:"removed,omitempty"`
+	}
+
+	var output struct {
+		SnipID           int64            `json:"snip_id"`
+		From             int32            `json:"from"`
+		To               int32            `json:"to"`
+		Title            *change          `json:"title,omitempty"`
+		Tags             *tagChanges      `json:"tags,omitempty"`
+		Unified          string           `json:"unified,omitempty"`
+		Hunks            []diff.Hunk      `json:"hunks,omitempty"`
+		SideBySide       []diff.SplitHunk `json:"side_by_side,omitempty"`
+		ContentUnchanged bool             `json:"content_unchanged"`
+	}
+
+	output.SnipID = snip.ID
+	output.From = older.Version
+	output.To = newer.Version
+
+	if older.Title != newer.Title {
+		output.Title = &change{From: older.Title, To: newer.Title}
+	}
+
+	var tags tagChanges
+	for _, tag := range newer.Tags {
+		if !slices.Contains(older.Tags, tag) {
+			tags.Added = append(tags.Added, tag)
+		}
+	}
+	for _, tag := range older.Tags {
+		if !slices.Contains(newer.Tags, tag) {
+			tags.Removed = append(tags.Removed, tag)
+		}
+	}
+	if tags.Added != nil || tags.Removed != nil {
+		output.Tags = &tags
+	}
+
+	hunks := diff.Hunks(diff.Lines(older.Content, newer.Content), contextLines)
+	output.ContentUnchanged = len(hunks) == 0
+
+	switch format {
+	case "hunks":
+		output.Hunks = hunks
+	case "side-by-side":
+		output.SideBySide = diff.SideBySide(hunks)
+	default:
+		oldName := fmt.Sprintf("snips/%d@%d", snip.ID, older.Version)
+		newName := fmt.Sprintf("snips/%d@%d", snip.ID, newer.Version)
+		output.Unified = diff.Unified(oldName, newName, hunks)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"diff": output}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
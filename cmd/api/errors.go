@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
 )
 
 // Comment for testing.
@@ -83,7 +84,82 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// Used when the request body is in a format the endpoint doesn't accept. For PATCH
+// requests the accepted formats are also listed in the Accept-Patch header, as RFC 5789
+// recommends.
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, accepted ...string) {
+	if r.Method == http.MethodPatch {
+		w.Header().Set("Accept-Patch", strings.Join(accepted, ", "))
+	}
+
+	message := fmt.Sprintf("the request body must be one of: %s", strings.Join(accepted, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+// Used when an If-Match header doesn't match the current version of the record.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has changed since you last fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// Used when an edit made against an older version of a snip can't be merged with the
+// changes made since. Alongside the error message the response contains the details of
+// the conflict, including the content with conflict markers, and the current version of
+// the snip so the client can resolve the conflict and try again.
+func (app *application) mergeConflictResponse(w http.ResponseWriter, r *http.Request, conflict any, current any) {
+	env := envelope{
+		"error":    "unable to merge your changes with the current version of the record",
+		"conflict": conflict,
+		"current":  current,
+	}
+
+	err := app.writeJSON(w, http.StatusConflict, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
+
+// Used when the client provides an email address and password combination that doesn't
+// match any active user.
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Used when the Authorization header is malformed, or the bearer token it contains is
+// unknown or expired. The WWW-Authenticate header tells the client which
+// authentication scheme it should be using, as required for 401 responses.
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Used when an anonymous user tries to access an endpoint which requires
+// authentication.
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// Used when an authenticated user hasn't activated their account yet.
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// Used when the user doesn't hold the permission needed for the resource, or doesn't
+// own the record they are trying to change.
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
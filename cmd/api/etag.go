@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+)
+
+// snipETag returns a strong entity tag for a snip. The version is bumped on every
+// change, so the id and version together identify the exact representation.
+func snipETag(snip *data.Snip) string {
+	return fmt.Sprintf(`"%d-%d"`, snip.ID, snip.Version)
+}
+
+// listETag returns a strong entity tag for a page of snips. It hashes the id and
+// version of every snip on the page along with the pagination metadata and any facets,
+// so the tag changes whenever any snip on the page, or the set of matching snips,
+// changes.
+func listETag(snips []*data.Snip, metadata data.Metadata, facets *data.Facets) string {
+	h := sha256.New()
+
+	for _, snip := range snips {
+		fmt.Fprintf(h, "%d-%d,", snip.ID, snip.Version)
+	}
+	fmt.Fprintf(h, "%+v", metadata)
+
+	if facets != nil {
+		fmt.Fprintf(h, "%+v", *facets)
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether etag is listed in the value of an If-Match or
+// If-None-Match header. The value may be "*", which matches any current
+// representation, or a comma-separated list of entity tags. If-None-Match uses the
+// weak comparison function from RFC 9110, which ignores the W/ prefix, whereas If-Match
+// uses the strong comparison function, where weak tags never match.
+func etagMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified sets the ETag header and, if the request carries an If-None-Match header
+// matching it, sends a 304 Not Modified response. It returns true when the response has
+// been sent and the handler should stop.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	return false
+}
+
+// checkPreconditions verifies the If-Match and X-Expected-Version headers against the
+// current state of the snip, before it is changed. A failed If-Match check sends a 412
+// Precondition Failed response. X-Expected-Version predates If-Match support and is kept
+// as an alias for clients that still send it, answering with 409 Conflict as before. It
+// returns false when a response has been sent and the handler should stop.
+func (app *application) checkPreconditions(w http.ResponseWriter, r *http.Request, snip *data.Snip) bool {
+	if im := r.Header.Get("If-Match"); im != "" && !etagMatches(im, snipETag(snip), false) {
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+
+	if ev := r.Header.Get("X-Expected-Version"); ev != "" && ev != fmt.Sprint(snip.Version) {
+		app.editConflictResponse(w, r)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/snippets"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// The most snips a single export may contain.
+const maxExportSnips = 1000
+
+// exportSnipsHandler converts the snips matching the same search parameters as the list
+// endpoint into the snippet file of an editor, chosen by the format parameter. Every
+// matching snip is exported, not just a single page.
+func (app *application) exportSnipsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	search := app.readSnipSearch(r, qs, v)
+	format := app.readString(qs, "format", "")
+
+	exporter, ok := snippets.Exporters[format]
+	v.Check(ok, "format", `must be one of "vscode", "ultisnips", "yasnippet" or "jetbrains"`)
+
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     100,
+		Sort:         app.readString(qs, "sort", "id"),
+		SortSafelist: []string{"id", "title", "-id", "-title"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var snips []*data.Snip
+
+	for {
+		page, metadata, _, err := app.models.Snips.GetAll(search, filters)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if metadata.TotalRecords > maxExportSnips {
+			v.AddError("q", fmt.Sprintf("matches more than %d snips, narrow the search to export them", maxExportSnips))
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		snips = append(snips, page...)
+
+		if filters.Page >= metadata.LastPage {
+			break
+		}
+		filters.Page++
+	}
+
+	out, err := exporter.Export(snips)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", exporter.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exporter.Filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
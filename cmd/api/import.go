@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/snippets"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// The outcomes of importing a snippet.
+const (
+	importCreated = "created"
+	importSkipped = "skipped"
+	importInvalid = "invalid"
+)
+
+// importResult reports what happened to a single snippet in an imported file.
+type importResult struct {
+	Name   string            `json:"name"`
+	Status string            `json:"status"`
+	ID     int64             `json:"id,omitempty"`
+	Slug   string            `json:"slug,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// importSnipsHandler creates a snip for each snippet in an editor snippet file sent as
+// the request body. Each snippet is validated and saved on its own, so one bad snippet
+// doesn't stop the rest, and the response reports what happened to every one of them.
+// The optional filetype parameter adds a tag to every snip, for formats such as
+// UltiSnips where the language comes from the name of the file.
+func (app *application) importSnipsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	format := app.readString(qs, "format", "")
+	filetype := app.config.tags.NormalizeTag(app.readString(qs, "filetype", ""))
+
+	importer, ok := snippets.Importers[format]
+	v.Check(ok, "format", `must be one of "vscode", "ultisnips" or "textmate"`)
+
+	if filetype != "" {
+		data.ValidateTag(v, "filetype", filetype)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	body, err := app.readBody(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entries, err := importer(body)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	results := make([]importResult, 0, len(entries))
+	summary := map[string]int{importCreated: 0, importSkipped: 0, importInvalid: 0}
+
+	for _, entry := range entries {
+		result := importResult{Name: entry.Name}
+
+		snip := entry.Snip
+		snip.OwnerID = user.ID
+		if filetype != "" {
+			snip.Tags = append(snip.Tags, filetype)
+		}
+		snip.Tags = app.config.tags.Normalize(snip.Tags)
+
+		v := validator.New()
+		data.ValidateSnip(v, snip)
+
+		switch {
+		case snip.Content == "":
+			result.Status, result.Reason = importSkipped, "snippet has no body"
+
+		case !v.Valid():
+			result.Status, result.Errors = importInvalid, v.Errors
+
+		default:
+			err := app.models.Snips.Insert(snip)
+			if err != nil {
+				switch {
+				// A snip with the same slug is most likely the same snippet, imported
+				// before.
+				case errors.Is(err, data.ErrDuplicateSlug):
+					result.Status, result.Reason = importSkipped, "a snip with this slug already exists"
+				default:
+					app.serverErrorResponse(w, r, err)
+					return
+				}
+				break
+			}
+
+			result.Status, result.ID = importCreated, snip.ID
+		}
+
+		result.Slug = snip.Slug
+		summary[result.Status]++
+		results = append(results, result)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results, "summary": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
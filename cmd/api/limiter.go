@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// clientLimiters holds a token bucket for each client, keyed by "ip:<address>" or
+// "user:<id>", along with when each client was last seen so idle ones can be forgotten.
+type clientLimiters struct {
+	mu      sync.Mutex
+	clients map[string]*limitedClient
+	rps     float64
+	burst   int
+}
+
+type limitedClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newClientLimiters(rps float64, burst int) *clientLimiters {
+	return &clientLimiters{
+		clients: make(map[string]*limitedClient),
+		rps:     rps,
+		burst:   burst,
+	}
+}
+
+// client returns the bucket for key, creating it if needed. The caller must hold mu.
+func (l *clientLimiters) client(key string, now time.Time) *limitedClient {
+	c, found := l.clients[key]
+	if !found {
+		c = &limitedClient{limiter: rate.NewLimiter(rate.Limit(l.rps), l.burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+
+	return c
+}
+
+// allow takes a token from the bucket for key, if there is one. It reports whether it
+// did, and how many tokens are left.
+func (l *clientLimiters) allow(key string) (bool, float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	c := l.client(key, now)
+
+	allowed := c.limiter.AllowN(now, 1)
+	return allowed, c.limiter.TokensAt(now)
+}
+
+// tokens returns how many tokens are left in the bucket for key, without taking one.
+func (l *clientLimiters) tokens(key string) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	return l.client(key, now).limiter.TokensAt(now)
+}
+
+// retryAfter returns how many seconds a client with the given tokens left has to wait
+// for the next one. Tokens refill at rps per second, so the next one arrives once the
+// missing fraction of a token has been refilled.
+func (l *clientLimiters) retryAfter(tokens float64) int {
+	if l.rps <= 0 {
+		return 1
+	}
+
+	return max(int(math.Ceil((1-tokens)/l.rps)), 1)
+}
+
+// forget removes clients which haven't been seen for longer than idle.
+func (l *clientLimiters) forget(idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, c := range l.clients {
+		if time.Since(c.lastSeen) > idle {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// forgetIdleClients removes rate limited clients which haven't been seen for a while
+// once a minute, so the limiters don't grow forever. It runs until the server shuts
+// down.
+func (app *application) forgetIdleClients() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-app.shutdown:
+			return
+		}
+
+		app.limiters.forget(3 * time.Minute)
+	}
+}
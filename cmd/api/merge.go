@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/diff"
+)
+
+// snipEdit holds the fields a client asked to change in a PATCH request. Nil fields are
+// left as they are.
+type snipEdit struct {
+	Title     *string
+	Slug      *string
+	Content   *string
+	Tags      []string
+	Variables *data.Variables
+}
+
+// mergeConflict describes the parts of an edit which couldn't be merged automatically.
+// Content holds the merged content with conflict markers around each conflicting
+// region, when the content was one of the conflicting fields.
+type mergeConflict struct {
+	BaseVersion    int32    `json:"base_version"`
+	CurrentVersion int32    `json:"current_version"`
+	Fields         []string `json:"fields"`
+	Content        string   `json:"content,omitempty"`
+	Regions        int      `json:"regions,omitempty"`
+}
+
+// applySnipEdit copies the edited fields onto the snip, overwriting its current values.
+func applySnipEdit(snip *data.Snip, edit snipEdit) {
+	if edit.Title != nil {
+		snip.Title = *edit.Title
+	}
+	if edit.Slug != nil {
+		snip.Slug = *edit.Slug
+	}
+	if edit.Content != nil {
+		snip.Content = *edit.Content
+	}
+	if edit.Tags != nil {
+		snip.Tags = edit.Tags // Note that we don't need to dereference a slice.
+	}
+	if edit.Variables != nil {
+		snip.Variables = *edit.Variables
+	}
+}
+
+// mergeSnipEdit applies an edit which was made against an older version of the snip
+// (base) on top of the current version. Only the changes the client made relative to
+// base are applied, so changes made by other editors in the meantime are kept:
+//
+//   - the content is merged line by line with a three-way merge;
+//   - the title and variables are taken from whichever side changed them, and
+//     conflict if both did;
+//   - tags added or removed by the client are added to or removed from the current tags;
+//   - the slug isn't versioned, so an edited slug simply replaces the current one.
+//
+// If any field conflicts, the snip is left untouched and the conflict is returned.
+func mergeSnipEdit(base *data.Revision, current *data.Snip, edit snipEdit) *mergeConflict {
+	conflict := &mergeConflict{
+		BaseVersion:    base.Version,
+		CurrentVersion: current.Version,
+	}
+
+	title := current.Title
+	if edit.Title != nil && *edit.Title != base.Title && *edit.Title != current.Title {
+		if current.Title == base.Title {
+			title = *edit.Title
+		} else {
+			conflict.Fields = append(conflict.Fields, "title")
+		}
+	}
+
+	variables := current.Variables
+	if edit.Variables != nil && !reflect.DeepEqual(*edit.Variables, base.Variables) && !reflect.DeepEqual(*edit.Variables, current.Variables) {
+		if reflect.DeepEqual(current.Variables, base.Variables) {
+			variables = *edit.Variables
+		} else {
+			conflict.Fields = append(conflict.Fields, "variables")
+		}
+	}
+
+	content := current.Content
+	if edit.Content != nil {
+		labels := diff.MergeLabels{
+			Ours:   fmt.Sprintf("current (version %d)", current.Version),
+			Base:   fmt.Sprintf("base (version %d)", base.Version),
+			Theirs: "yours",
+		}
+
+		merged, regions := diff.Merge(base.Content, current.Content, *edit.Content, labels)
+		if regions > 0 {
+			conflict.Fields = append(conflict.Fields, "content")
+			conflict.Content = merged
+			conflict.Regions = regions
+		}
+		content = merged
+	}
+
+	tags := slices.Clone(current.Tags)
+	if edit.Tags != nil {
+		for _, tag := range edit.Tags {
+			if !slices.Contains(base.Tags, tag) && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		tags = slices.DeleteFunc(tags, func(tag string) bool {
+			return slices.Contains(base.Tags, tag) && !slices.Contains(edit.Tags, tag)
+		})
+	}
+
+	if len(conflict.Fields) > 0 {
+		return conflict
+	}
+
+	current.Title = title
+	if edit.Slug != nil {
+		current.Slug = *edit.Slug
+	}
+	current.Content = content
+	current.Tags = tags
+	current.Variables = variables
+
+	return nil
+}
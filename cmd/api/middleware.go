@@ -1,10 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
-	"golang.org/x/time/rate"
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
 )
 
 // Below is an example of how these middleware functions works.
@@ -32,8 +37,6 @@ func commonHeaders(next http.Handler) http.Handler {
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
 		// Force communication using HTTPS, preventing HTTP use
 		w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
-		// Configure same-origin policy
-		w.Header().Set("Access-Control-Allow-Origin", "same-origin")
 		// Referrer-Policy
 		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
 		// Disallow the browser from MIME-sniffing a response away from the declared content-type
@@ -44,12 +47,60 @@ func commonHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// realIP resolves the IP address of the client which sent the request, looking past any
+// trusted proxies in front of the server, and stores it in the request context for the
+// middleware and handlers which follow.
+func (app *application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = app.contextSetClientIP(r, app.resolveClientIP(r))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// enableCORS lets browser front-ends served from the origins listed in the
+// -cors-trusted-origins flag call the API, including with credentials. Matching origins
+// are reflected back in Access-Control-Allow-Origin, and preflight requests from them
+// are answered here, before authentication and rate limiting, as browsers send them
+// without credentials. Requests from any other origin are passed on untouched, so the
+// browser's same-origin policy applies to them.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the origin and, for preflights, on what is being
+		// asked for, so caches need to keep them apart.
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" || !slices.Contains(app.config.cors.trustedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Expose-Headers", "Accept-Patch, Content-Disposition, ETag, Location, RateLimit-Limit, RateLimit-Remaining, Retry-After, WWW-Authenticate")
+
+		// A preflight is an OPTIONS request with an Access-Control-Request-Method header.
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, X-Expected-Version")
+			w.Header().Set("Access-Control-Max-Age", "600")
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Logs the details of each incoming request. It captures and logs the client's IP address,
-// the protocol used, the HTTP method, and the requested URI.
+// the protocol used, the HTTP method, and the requested URI. It has to run after realIP().
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
-			ip     = r.RemoteAddr
+			ip     = app.contextGetClientIP(r)
 			proto  = r.Proto
 			method = r.Method
 			uri    = r.URL.RequestURI()
@@ -85,22 +136,229 @@ func (app *application) gracefulRecovery(next http.Handler) http.Handler {
 	})
 }
 
-// rateLimit limits the number of requests a client is allowed to make during a specific set of time.
+// rateLimit limits the number of requests each client is allowed to make. Clients are
+// told their limit and how many requests they have left in the RateLimit-Limit and
+// RateLimit-Remaining headers, and when to try again in Retry-After once they run out.
+// It has to run after authenticate(), so that authenticated users are limited as
+// themselves, wherever they connect from, rather than by their IP address.
 func (app *application) rateLimit(next http.Handler) http.Handler {
-	// Init a new rate limiter which allows an average of 2 requests per second, with a max of 4
-	// requests in a single burst.
-	limiter := rate.NewLimiter(2, 4)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.limiter.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + app.contextGetClientIP(r)
+		if user := app.contextGetUser(r); !user.IsAnonymous() {
+			key = fmt.Sprintf("user:%d", user.ID)
+		}
 
-	// The function we are returning is a closure, which 'closes over' the limiter variable.
+		allowed, tokens := app.limiters.allow(key)
+		if !app.rateLimitHeaders(w, allowed, tokens) {
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitAuthentication throttles token guessing. Requests with an Authorization header
+// are only let through to authenticate(), and its database lookup, while the client's
+// IP address has requests left, and every one which fails authentication is counted
+// against it. It has to run before authenticate().
+func (app *application) limitAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Call limiter.Allow() to see if the request is permitted, and if it's not,
-		// then we call the rateLimitExceededResponse() helper to return a 429 Too Many
-		// Requests response (we will create this helper in a minute).
-		if !limiter.Allow() {
+		if !app.config.limiter.enabled || r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + app.contextGetClientIP(r)
+
+		if tokens := app.limiters.tokens(key); tokens < 1 {
+			app.rateLimitHeaders(w, false, tokens)
 			app.rateLimitExceededResponse(w, r)
 			return
 		}
 
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		// A request with an Authorization header only gets a 401 when its token is
+		// invalid.
+		if sw.status == http.StatusUnauthorized {
+			app.limiters.allow(key)
+		}
+	})
+}
+
+// rateLimitHeaders sets the RateLimit-Limit and RateLimit-Remaining headers, and
+// Retry-After if the request isn't allowed. It returns allowed for convenience.
+func (app *application) rateLimitHeaders(w http.ResponseWriter, allowed bool, tokens float64) bool {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(app.config.limiter.burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(max(int(tokens), 0)))
+
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(app.limiters.retryAfter(tokens)))
+	}
+
+	return allowed
+}
+
+// statusWriter records the status code written to the wrapped ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// authenticate resolves the caller from the "Authorization: Bearer <token>" header and
+// stores the matching user in the request context. Requests without an Authorization
+// header are treated as coming from the AnonymousUser.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Add the "Vary: Authorization" header to the response. This indicates to any
+		// caches that the response may vary based on the value of the Authorization
+		// header in the request.
+		w.Header().Add("Vary", "Authorization")
+
+		// Retrieve the value of the Authorization header from the request. This will
+		// return the empty string "" if there is no such header found.
+		authorizationHeader := r.Header.Get("Authorization")
+
+		// If there is no Authorization header found, use the contextSetUser() helper
+		// to add the AnonymousUser to the request context. Then we call the next
+		// handler in the chain and return without executing any of the code below.
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Otherwise, we expect the value of the Authorization header to be in the format
+		// "Bearer <token>". We try to split this into its constituent parts, and if the
+		// header isn't in the expected format we return a 401 Unauthorized response.
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		// Extract the actual authentication token from the header parts.
+		token := headerParts[1]
+
+		// Validate the token to make sure it is in a sensible format.
+		v := validator.New()
+
+		// If the token isn't valid, use the invalidAuthenticationTokenResponse()
+		// helper to send a response, rather than the failedValidationResponse() helper.
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		// Retrieve the details of the user associated with the authentication token,
+		// again calling the invalidAuthenticationTokenResponse() helper if no
+		// matching record was found.
+		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// Call the contextSetUser() helper to add the user information to the request
+		// context.
+		r = app.contextSetUser(r, user)
+
+		// Call the next handler in the chain.
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAuthenticatedUser checks that a user is not anonymous.
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireActivatedUser checks that a user is both authenticated and activated.
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	// Rather than returning this http.HandlerFunc we assign it to the variable fn.
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		// Check that a user is activated.
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
+
+	// Wrap fn with the requireAuthenticatedUser() middleware before returning it.
+	return app.requireAuthenticatedUser(fn)
+}
+
+// requirePermission checks that an activated user holds the given permission code. Note
+// that the first parameter for the middleware function is the permission code that we
+// require the user to have.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve the user from the request context.
+		user := app.contextGetUser(r)
+
+		// Get the slice of permissions for the user.
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// Check if the slice includes the required permission. If it doesn't, then
+		// return a 403 Forbidden response.
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		// Otherwise they have the required permission so we call the next handler in
+		// the chain.
+		next.ServeHTTP(w, r)
+	}
+
+	// Wrap this with the requireActivatedUser() middleware before returning it.
+	return app.requireActivatedUser(fn)
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/patch"
+)
+
+// Members of the snip document which a patch may change. Every other member is read
+// only, although JSON Patch "test" operations may still check them.
+var patchableSnipFields = []string{"title", "slug", "content", "tags", "variables"}
+
+// snipDocument returns the JSON document which patches are applied to. Unlike the
+// normal JSON encoding of a snip, every member is always present, so that operations
+// such as "replace /content" work on snips with empty content.
+func snipDocument(snip *data.Snip) ([]byte, error) {
+	tags := snip.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	variables := snip.Variables
+	if variables == nil {
+		variables = data.Variables{}
+	}
+
+	return json.Marshal(map[string]any{
+		"id":         snip.ID,
+		"created_at": snip.CreatedAt,
+		"title":      snip.Title,
+		"slug":       snip.Slug,
+		"content":    snip.Content,
+		"tags":       tags,
+		"variables":  variables,
+		"owner_id":   snip.OwnerID,
+		"version":    snip.Version,
+	})
+}
+
+// readSnipPatch reads a JSON Merge Patch or JSON Patch from the request body, applies
+// it to the snip document and returns the resulting changes as a snipEdit. Patches
+// which change read-only members, or add members a snip doesn't have, are rejected.
+// The snip itself is not modified.
+func (app *application) readSnipPatch(w http.ResponseWriter, r *http.Request, snip *data.Snip, mediaType string) (snipEdit, error) {
+	body, err := app.readBody(w, r)
+	if err != nil {
+		return snipEdit{}, err
+	}
+
+	doc, err := snipDocument(snip)
+	if err != nil {
+		return snipEdit{}, err
+	}
+
+	var patched []byte
+	switch mediaType {
+	case patch.MergePatchType:
+		patched, err = patch.MergePatch(doc, body)
+	default:
+		var ops []patch.Operation
+		ops, err = patch.DecodeOperations(body)
+		if err == nil {
+			patched, err = patch.Apply(doc, ops)
+		}
+	}
+	if err != nil {
+		return snipEdit{}, err
+	}
+
+	var before, after map[string]json.RawMessage
+
+	err = json.Unmarshal(doc, &before)
+	if err != nil {
+		return snipEdit{}, err
+	}
+
+	// A patch may replace the whole document with something other than an object.
+	err = json.Unmarshal(patched, &after)
+	if err != nil || after == nil {
+		return snipEdit{}, fmt.Errorf("patched snip must be a JSON object")
+	}
+
+	for key, value := range after {
+		if _, ok := before[key]; !ok {
+			return snipEdit{}, fmt.Errorf("snip has no member %q", key)
+		}
+		if !slices.Contains(patchableSnipFields, key) && !bytes.Equal(value, before[key]) {
+			return snipEdit{}, fmt.Errorf("member %q cannot be changed", key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok && !slices.Contains(patchableSnipFields, key) {
+			return snipEdit{}, fmt.Errorf("member %q cannot be removed", key)
+		}
+	}
+
+	// Removing a patchable member resets it to its zero value, which validation will
+	// then catch where that isn't allowed (an empty title, for instance).
+	var result struct {
+		Title     string         `json:"title"`
+		Slug      string         `json:"slug"`
+		Content   string         `json:"content"`
+		Tags      []string       `json:"tags"`
+		Variables data.Variables `json:"variables"`
+	}
+
+	for _, key := range patchableSnipFields {
+		value, ok := after[key]
+		if !ok {
+			continue
+		}
+
+		var dst any
+		switch key {
+		case "title":
+			dst = &result.Title
+		case "slug":
+			dst = &result.Slug
+		case "content":
+			dst = &result.Content
+		case "tags":
+			dst = &result.Tags
+		case "variables":
+			dst = &result.Variables
+		}
+
+		err = json.Unmarshal(value, dst)
+		if err != nil {
+			return snipEdit{}, fmt.Errorf("patched snip contains incorrect JSON type for member %q", key)
+		}
+	}
+
+	if result.Tags == nil {
+		result.Tags = []string{}
+	}
+
+	return snipEdit{Title: &result.Title, Slug: &result.Slug, Content: &result.Content, Tags: result.Tags, Variables: &result.Variables}, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies parses a comma or space separated list of CIDRs, such as
+// "10.0.0.0/8, 127.0.0.1". A bare IP address is treated as a single-address prefix.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", field)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", field)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// parseTrustedProxyHeader returns the canonical name of the header which trusted
+// proxies report the client IP in.
+func parseTrustedProxyHeader(s string) (string, error) {
+	header := http.CanonicalHeaderKey(strings.TrimSpace(s))
+
+	switch header {
+	case "Forwarded", "X-Forwarded-For", "X-Real-Ip":
+		return header, nil
+	default:
+		return "", fmt.Errorf("invalid trusted proxy header %q", s)
+	}
+}
+
+// trustedProxy reports whether addr belongs to one of the configured trusted proxies.
+func (app *application) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range app.config.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveClientIP returns the IP address of the client which sent the request. When the
+// immediate peer is a trusted proxy, the address it reports is used instead, taken from
+// the header named by the -trusted-proxy-header flag. Only that header is read, as the
+// proxy only overwrites its own header, and a client could set any of the others to
+// whatever it likes.
+//
+// Proxies append the address they received the request from to the end of the chain,
+// so the chain is walked from right to left, skipping over trusted proxies, and the
+// first untrusted address is the client. Anything to its left was supplied by the
+// client itself and can't be trusted. If the chain is malformed, the last address which
+// could be trusted is used.
+func (app *application) resolveClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	client := peer.Unmap()
+
+	if !app.trustedProxy(client) {
+		return client.String()
+	}
+
+	var chain []string
+	switch app.config.trustedHeader {
+	case "Forwarded":
+		chain = forwardedFor(r.Header.Values("Forwarded"))
+	case "X-Forwarded-For":
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			chain = append(chain, strings.Split(value, ",")...)
+		}
+	case "X-Real-Ip":
+		if value := r.Header.Get("X-Real-IP"); value != "" {
+			chain = []string{value}
+		}
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseForwardedAddr(chain[i])
+		if !ok {
+			break
+		}
+
+		client = addr
+		if !app.trustedProxy(addr) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// forwardedFor returns the "for" parameter of each element of the RFC 7239 Forwarded
+// header values, in order. Elements without one are returned as "", so they still
+// take up their place in the chain.
+func forwardedFor(values []string) []string {
+	var chain []string
+
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var node string
+
+			for _, pair := range strings.Split(element, ";") {
+				name, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(name, "for") {
+					node = val
+					break
+				}
+			}
+
+			chain = append(chain, node)
+		}
+	}
+
+	return chain
+}
+
+// parseForwardedAddr parses a single node from a forwarding header, which may be quoted,
+// and may carry a port, as in "192.0.2.1:8080" or "[2001:db8::1]:443". Obfuscated
+// identifiers and "unknown", which RFC 7239 allows, aren't addresses and are rejected.
+func parseForwardedAddr(node string) (netip.Addr, bool) {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+
+	if addrPort, err := netip.ParseAddrPort(node); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(node, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/render"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// A snipVersion identifies a version of a snip used in a render, so that the same
+// output can be produced again by pinning the included snips to those versions.
+type snipVersion struct {
+	ID      int64  `json:"id"`
+	Slug    string `json:"slug,omitempty"`
+	Version int32  `json:"version"`
+}
+
+// renderNode is a snip loaded for rendering, along with the snips it includes, keyed by
+// the reference used to include them. Height is how many levels of includes there are
+// below it, and output is its rendered content, once it has been rendered.
+type renderNode struct {
+	snip     *data.Snip
+	tmpl     *template.Template
+	values   map[string]any
+	includes map[string]*renderNode
+	height   int
+	output   *string
+}
+
+// renderLoader loads a snip and everything it includes for rendering. Each snip version
+// is only loaded once, however many times and wherever it is included, and the number
+// of snips included, as well as how deeply they're nested, is limited.
+type renderLoader struct {
+	fetch    func(ref data.SnipRef) (*data.Snip, error)
+	maxDepth int
+	maxSnips int
+	nodes    map[snipVersion]*renderNode
+	order    []*renderNode // Every node loaded, in the order they were loaded
+	versions []snipVersion
+}
+
+// renderSnipHandler renders the content of a snip as a template, substituting the
+// values supplied for its variables. Missing values fall back to the defaults declared
+// on the snip. Snips included with {{include "slug"}} are rendered in place, with the
+// same values, and every snip version used is listed in the response.
+func (app *application) renderSnipHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Values map[string]any `json:"values"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	snip, err := app.models.Snips.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+
+	// Load the snip and everything it includes up front, so that missing snips, cycles
+	// and overly deep nesting are reported before anything is rendered, and no queries
+	// run inside the sandbox.
+	loader := app.newRenderLoader()
+
+	root, err := loader.load(v, snip, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Every snip is rendered with the same values, so each one only sees the values for
+	// the variables it declares, and a value is only unknown if no snip declares it.
+	var variables data.Variables
+
+	for _, node := range loader.order {
+		node.values = data.ResolveValues(v, node.snip.Variables, pickValues(input.Values, node.snip.Variables))
+		variables = append(variables, node.snip.Variables...)
+	}
+
+	for name := range input.Values {
+		if !slices.ContainsFunc(variables, func(variable data.Variable) bool { return variable.Name == name }) {
+			v.AddError("values."+name, "is not a variable of this snip or the snips it includes")
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	limits := render.Limits{MaxOutput: app.config.render.maxOutput, Timeout: app.config.render.timeout}
+
+	rendered, err := loader.render(root, render.NewBudget(limits))
+	if err != nil {
+		switch {
+		case errors.Is(err, render.ErrOutputTooLarge), errors.Is(err, render.ErrTimeout):
+			v.AddError("content", err.Error())
+		default:
+			v.AddError("content", "could not be rendered: "+err.Error())
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"rendered": rendered, "values": root.values, "versions": loader.versions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newRenderLoader returns a loader which fetches snips from the database, within the
+// configured include limits.
+func (app *application) newRenderLoader() *renderLoader {
+	return &renderLoader{
+		fetch:    app.models.Snips.GetRef,
+		maxDepth: app.config.render.maxIncludeDepth,
+		maxSnips: app.config.render.maxIncludes,
+		nodes:    make(map[snipVersion]*renderNode),
+	}
+}
+
+// load parses the content of a snip and recursively loads the snips it includes.
+// Problems with the content or the includes are added to the validator, and only
+// database errors are returned. Path holds the snips which include this one.
+func (l *renderLoader) load(v *validator.Validator, snip *data.Snip, path []*data.Snip) (*renderNode, error) {
+	version := snipVersion{ID: snip.ID, Slug: snip.Slug, Version: snip.Version}
+	l.versions = append(l.versions, version)
+
+	// Snips saved before they declared variables may not be valid templates, so parse
+	// errors are reported against the content rather than treated as server errors.
+	tmpl, err := render.Parse("content", snip.Content, nil)
+	if err != nil {
+		v.AddError("content", describeInclude(path, snip)+"must be a valid template: "+err.Error())
+		return nil, nil
+	}
+
+	node := &renderNode{snip: snip, tmpl: tmpl, includes: make(map[string]*renderNode)}
+	l.nodes[version] = node
+	l.order = append(l.order, node)
+
+	path = append(path, snip)
+
+	for _, s := range render.Includes(tmpl) {
+		ref, err := data.ParseSnipRef(s)
+		if err != nil {
+			v.AddError("content", describeInclude(path[:len(path)-1], snip)+"must only include valid snip references: "+err.Error())
+			return nil, nil
+		}
+
+		if len(path) > l.maxDepth {
+			v.AddError("content", fmt.Sprintf("includes must not be nested more than %d deep", l.maxDepth))
+			return nil, nil
+		}
+
+		included, err := l.fetch(ref)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("content", fmt.Sprintf("%sincludes %q, which does not exist", describeInclude(path[:len(path)-1], snip), s))
+				return nil, nil
+			default:
+				return nil, err
+			}
+		}
+
+		if slices.ContainsFunc(path, func(p *data.Snip) bool { return p.ID == included.ID }) {
+			v.AddError("content", "includes must not form a cycle: "+describePath(append(path, included)))
+			return nil, nil
+		}
+
+		// A snip which has already been loaded is reused, as long as the includes below
+		// it aren't nested too deep from here.
+		child, found := l.nodes[snipVersion{ID: included.ID, Slug: included.Slug, Version: included.Version}]
+		if found {
+			if len(path)+child.height > l.maxDepth {
+				v.AddError("content", fmt.Sprintf("includes must not be nested more than %d deep", l.maxDepth))
+				return nil, nil
+			}
+		} else {
+			// The snip being rendered doesn't count towards the limit.
+			if len(l.order) > l.maxSnips {
+				v.AddError("content", fmt.Sprintf("must not include more than %d snips in total", l.maxSnips))
+				return nil, nil
+			}
+
+			child, err = l.load(v, included, path)
+			if child == nil || err != nil {
+				return nil, err
+			}
+		}
+
+		node.includes[s] = child
+		node.height = max(node.height, child.height+1)
+	}
+
+	return node, nil
+}
+
+// render renders a loaded snip, along with the snips it includes, within the budget.
+// Every snip is rendered at most once, and its output reused wherever it's included.
+func (l *renderLoader) render(node *renderNode, budget *render.Budget) (string, error) {
+	if node.output != nil {
+		return *node.output, nil
+	}
+
+	node.tmpl.Funcs(template.FuncMap{render.IncludeFunc: func(ref string) (string, error) {
+		return l.render(node.includes[ref], budget)
+	}})
+
+	output, err := budget.Execute(node.tmpl, node.values)
+	if err != nil {
+		return "", err
+	}
+	node.output = &output
+
+	return output, nil
+}
+
+// pickValues returns the values for the given variables.
+func pickValues(values map[string]any, variables data.Variables) map[string]any {
+	picked := make(map[string]any, len(variables))
+
+	for _, variable := range variables {
+		if value, ok := values[variable.Name]; ok {
+			picked[variable.Name] = value
+		}
+	}
+
+	return picked
+}
+
+// describeInclude returns a prefix for error messages about an included snip, or an
+// empty string for the snip being rendered.
+func describeInclude(path []*data.Snip, snip *data.Snip) string {
+	if len(path) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("included snip %s ", describePath(append(path, snip)))
+}
+
+// describePath formats a chain of includes, such as "3 -> license@2".
+func describePath(path []*data.Snip) string {
+	names := make([]string, len(path))
+
+	for i, snip := range path {
+		name := fmt.Sprint(snip.ID)
+		if snip.Slug != "" {
+			name = snip.Slug
+		}
+		names[i] = fmt.Sprintf("%s@%d", name, snip.Version)
+	}
+
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/render"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// testLoader returns a render loader which fetches snips by slug from the given
+// contents, counting how many times each one is fetched.
+func testLoader(contents map[string]string, fetches map[string]int) *renderLoader {
+	ids := make(map[string]int64)
+	for slug := range contents {
+		ids[slug] = int64(len(ids) + 1)
+	}
+
+	return &renderLoader{
+		fetch: func(ref data.SnipRef) (*data.Snip, error) {
+			content, ok := contents[ref.Slug]
+			if !ok {
+				return nil, data.ErrRecordNotFound
+			}
+			fetches[ref.Slug]++
+			return &data.Snip{ID: ids[ref.Slug], Slug: ref.Slug, Content: content, Version: 1}, nil
+		},
+		maxDepth: 3,
+		maxSnips: 5,
+		nodes:    make(map[snipVersion]*renderNode),
+	}
+}
+
+func TestRenderLoader(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents map[string]string
+		err      string
+		output   string
+	}{
+		{
+			name:     "include",
+			contents: map[string]string{"root": `a{{include "b"}}c`, "b": "B"},
+			output:   "aBc",
+		},
+		{
+			name:     "repeated include",
+			contents: map[string]string{"root": `{{include "b"}}{{include "b"}}`, "b": `[{{include "c"}}]`, "c": "C"},
+			output:   "[C][C]",
+		},
+		{
+			name:     "missing",
+			contents: map[string]string{"root": `{{include "nope"}}`},
+			err:      `includes "nope", which does not exist`,
+		},
+		{
+			name:     "cycle",
+			contents: map[string]string{"root": `{{include "b"}}`, "b": `{{include "c"}}`, "c": `{{include "b"}}`},
+			err:      "includes must not form a cycle",
+		},
+		{
+			name:     "self",
+			contents: map[string]string{"root": `{{include "root"}}`},
+			err:      "includes must not form a cycle",
+		},
+		{
+			name:     "at the depth limit",
+			contents: map[string]string{"root": `{{include "a"}}`, "a": `{{include "b"}}`, "b": `{{include "c"}}`, "c": "deep"},
+			output:   "deep",
+		},
+		{
+			name:     "too deep",
+			contents: map[string]string{"root": `{{include "a"}}`, "a": `{{include "b"}}`, "b": `{{include "c"}}`, "c": `{{include "d"}}`, "d": ""},
+			err:      "includes must not be nested more than 3 deep",
+		},
+		{
+			// c is first loaded near the top, and reused further down, where the snip it
+			// includes ends up too deep.
+			name:     "too deep when reused",
+			contents: map[string]string{"root": `{{include "c"}}{{include "a"}}`, "a": `{{include "b"}}`, "b": `{{include "c"}}`, "c": `{{include "d"}}`, "d": ""},
+			err:      "includes must not be nested more than 3 deep",
+		},
+		{
+			name:     "too many snips",
+			contents: map[string]string{"root": `{{include "a"}}{{include "b"}}{{include "c"}}{{include "d"}}{{include "e"}}{{include "f"}}`, "a": "", "b": "", "c": "", "d": "", "e": "", "f": ""},
+			err:      "must not include more than 5 snips in total",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetches := make(map[string]int)
+			loader := testLoader(tt.contents, fetches)
+
+			v := validator.New()
+
+			root, err := loader.load(v, &data.Snip{ID: 100, Slug: "root", Content: tt.contents["root"], Version: 1}, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.err != "" {
+				if v.Valid() || !strings.Contains(v.Errors["content"], tt.err) {
+					t.Fatalf("got errors %v; want %q", v.Errors, tt.err)
+				}
+				return
+			}
+			if !v.Valid() {
+				t.Fatalf("unexpected errors: %v", v.Errors)
+			}
+
+			for slug, n := range fetches {
+				if n > 1 {
+					t.Errorf("%s was fetched %d times", slug, n)
+				}
+			}
+
+			output, err := loader.render(root, render.NewBudget(render.Limits{MaxOutput: 1 << 10, Timeout: time.Second}))
+			if err != nil {
+				t.Fatalf("unexpected render error: %v", err)
+			}
+			if output != tt.output {
+				t.Errorf("got %q; want %q", output, tt.output)
+			}
+		})
+	}
+}
+
+func TestRenderLoaderSharesBudget(t *testing.T) {
+	// Each level includes the one below ten times, so the output grows tenfold per
+	// level. With a budget per snip each level would fit, but not all of them together.
+	contents := map[string]string{
+		"root": strings.Repeat(`{{include "a"}}`, 10),
+		"a":    strings.Repeat(`{{include "b"}}`, 10),
+		"b":    strings.Repeat("x", 9),
+	}
+
+	fetches := make(map[string]int)
+	loader := testLoader(contents, fetches)
+
+	v := validator.New()
+
+	root, err := loader.load(v, &data.Snip{ID: 100, Slug: "root", Content: contents["root"], Version: 1}, nil)
+	if err != nil || !v.Valid() {
+		t.Fatalf("unexpected error: %v %v", err, v.Errors)
+	}
+
+	_, err = loader.render(root, render.NewBudget(render.Limits{MaxOutput: 950, Timeout: time.Second}))
+	if !errors.Is(err, render.ErrOutputTooLarge) {
+		t.Errorf("got error %v; want %v", err, render.ErrOutputTooLarge)
+	}
+}
@@ -12,12 +12,42 @@ func (app *application) routes() http.Handler {
 	// endpoints using the HandleFunc() method.
 	mux.HandleFunc("GET /v1/healthcheck", app.healthcheckHandler)
 
-	mux.HandleFunc("GET /v1/snips", app.listSnipsHandler)
-	mux.HandleFunc("POST /v1/snips", app.createSnipHandler)
-	mux.HandleFunc("GET /v1/snips/{id}", app.showSnipHandler)
-	mux.HandleFunc("PATCH /v1/snips/{id}", app.updateSnipHandler)
-	mux.HandleFunc("DELETE /v1/snips/{id}", app.deleteSnipHandler)
-
-	// Return mux router with middleware.
-	return app.rateLimit(app.gracefulRecovery(app.logRequest((commonHeaders(mux)))))
+	mux.HandleFunc("GET /v1/snips", app.requirePermission("snips:read", app.listSnipsHandler))
+	mux.HandleFunc("POST /v1/snips", app.requirePermission("snips:write", app.createSnipHandler))
+	mux.HandleFunc("GET /v1/snips/suggest", app.requirePermission("snips:read", app.suggestSnipsHandler))
+	mux.HandleFunc("GET /v1/snips/export", app.requirePermission("snips:read", app.exportSnipsHandler))
+	mux.HandleFunc("POST /v1/snips/import", app.requirePermission("snips:write", app.importSnipsHandler))
+	mux.HandleFunc("GET /v1/snips/{id}", app.requirePermission("snips:read", app.showSnipHandler))
+	mux.HandleFunc("PATCH /v1/snips/{id}", app.requirePermission("snips:write", app.updateSnipHandler))
+	mux.HandleFunc("DELETE /v1/snips/{id}", app.requirePermission("snips:write", app.deleteSnipHandler))
+	mux.HandleFunc("GET /v1/snips/{id}/versions", app.requirePermission("snips:read", app.listSnipVersionsHandler))
+	mux.HandleFunc("GET /v1/snips/{id}/versions/{version}", app.requirePermission("snips:read", app.showSnipVersionHandler))
+	mux.HandleFunc("GET /v1/snips/{id}/diff", app.requirePermission("snips:read", app.diffSnipHandler))
+	mux.HandleFunc("POST /v1/snips/{id}/revert", app.requirePermission("snips:write", app.revertSnipHandler))
+	mux.HandleFunc("POST /v1/snips/{id}/restore", app.requirePermission("snips:write", app.restoreSnipHandler))
+	mux.HandleFunc("POST /v1/snips/{id}/render", app.requirePermission("snips:read", app.renderSnipHandler))
+
+	mux.HandleFunc("GET /v1/trash", app.requirePermission("snips:read", app.listTrashHandler))
+
+	mux.HandleFunc("GET /v1/tags", app.requirePermission("snips:read", app.listTagsHandler))
+	mux.HandleFunc("POST /v1/tags/merge", app.requirePermission("snips:admin", app.mergeTagsHandler))
+	mux.HandleFunc("POST /v1/tags/{tag}/rename", app.requirePermission("snips:admin", app.renameTagHandler))
+	mux.HandleFunc("DELETE /v1/tags/{tag}", app.requirePermission("snips:admin", app.deleteTagHandler))
+	mux.HandleFunc("GET /v1/tags/synonyms", app.requirePermission("snips:read", app.listTagSynonymsHandler))
+	mux.HandleFunc("PUT /v1/tags/synonyms/{synonym}", app.requirePermission("snips:admin", app.setTagSynonymHandler))
+	mux.HandleFunc("DELETE /v1/tags/synonyms/{synonym}", app.requirePermission("snips:admin", app.deleteTagSynonymHandler))
+
+	mux.HandleFunc("POST /v1/users", app.registerUserHandler)
+	mux.HandleFunc("PUT /v1/users/activated", app.activateUserHandler)
+	mux.HandleFunc("GET /v1/users/{id}/permissions", app.requirePermission("users:admin", app.showUserPermissionsHandler))
+	mux.HandleFunc("POST /v1/users/{id}/permissions", app.requirePermission("users:admin", app.grantUserPermissionsHandler))
+	mux.HandleFunc("DELETE /v1/users/{id}/permissions/{code}", app.requirePermission("users:admin", app.revokeUserPermissionHandler))
+
+	mux.HandleFunc("POST /v1/tokens/authentication", app.createAuthenticationTokenHandler)
+
+	// Return mux router with middleware. The client IP is resolved first, for logging
+	// and rate limiting. CORS preflights are answered before authentication. Failed
+	// authentication is limited by IP address before authenticate() runs, and every
+	// other request after it, so that authenticated users are limited individually.
+	return app.gracefulRecovery(app.realIP(app.logRequest(commonHeaders(app.enableCORS(app.limitAuthentication(app.authenticate(app.rateLimit(mux))))))))
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve() runs the HTTP server until it receives a SIGINT or SIGTERM signal, and then
+// shuts it down gracefully: the server stops accepting connections, in-flight requests
+// and background tasks are given the shutdown grace period to finish, and only then
+// does serve() return. A nil error means the server shut down cleanly.
+func (app *application) serve() error {
+	// TLS Config is set up for modern web, maybe remove some of these settings if needed.
+	// TLS 1.3 remains unaffected by all of this, as all of its connections are considered
+	// safe while writing this for Go 1.22.
+	tlsConfig := &tls.Config{
+		MinVersion:       tls.VersionTLS13,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+	}
+
+	// `srv` initializes an HTTP server with defined configuration for address, handlers,
+	// TLS settings, timeouts, and error logging.
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.routes(),
+		TLSConfig:    tlsConfig,
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	// The shutdown goroutine reports the outcome of the shutdown on this channel.
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String(), "grace_period", app.config.shutdownTimeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+		defer cancel()
+
+		// Tell long-running background tasks, such as purging the trash, to stop.
+		close(app.shutdown)
+
+		// Shutdown() stops accepting new connections and waits for in-flight requests
+		// to complete, or for the grace period to run out.
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		app.logger.Info("completing background tasks", "addr", srv.Addr)
+
+		// Wait for the background goroutines within what remains of the grace period.
+		done := make(chan struct{})
+		go func() {
+			app.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			shutdownError <- nil
+		case <-ctx.Done():
+			shutdownError <- errors.New("timed out waiting for background tasks to complete")
+		}
+	}()
+
+	app.logger.Info("starting server", "addr", srv.Addr, "env", app.config.env, "tls", app.config.useTLS, "log", app.config.useLog, "db", app.config.db.dsn)
+
+	// Start server with or without TLS. Once Shutdown() is called these return
+	// http.ErrServerClosed straight away, which is expected, so only other errors are
+	// returned.
+	var err error
+	if app.config.useTLS {
+		err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Wait for the shutdown to finish before returning.
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped server", "addr", srv.Addr)
+
+	return nil
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 
 	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/patch"
 	"github.com/pwilliams-ck/sniplate/internal/validator"
 )
 
@@ -14,9 +18,7 @@ func (app *application) listSnipsHandler(w http.ResponseWriter, r *http.Request)
 	// To keep things consistent with our other handlers, we'll define an input struct
 	// to hold the expected values from the request query string.
 	var input struct {
-		Title   string
-		Content string
-		Tags    []string
+		data.SnipSearch
 		data.Filters
 	}
 
@@ -26,20 +28,45 @@ func (app *application) listSnipsHandler(w http.ResponseWriter, r *http.Request)
 	// Call r.URL.Query() to get the url.Values map containing the query string data.
 	qs := r.URL.Query()
 
-	// Use our helpers to extract the title and genres query string values, falling back
-	// to defaults of an empty string and an empty slice respectively if they are not
-	// provided by the client.
-	input.Title = app.readString(qs, "title", "")
-	input.Content = app.readString(qs, "content", "")
-	input.Tags = app.readCSV(qs, "tags", []string{})
+	// Read the search parameters, which are shared with the export endpoint.
+	input.SnipSearch = app.readSnipSearch(r, qs, v)
+
+	// facets=tags adds counts of the most used tags across every matching snip, and
+	// facet_size sets how many tags are counted.
+	facets := app.readCSV(qs, "facets", []string{})
+	facetSize := app.readInt(qs, "facet_size", 10, v)
+
+	for _, facet := range facets {
+		v.Check(facet == "tags", "facets", `must only contain "tags"`)
+	}
+	v.Check(facetSize > 0, "facet_size", "must be greater than zero")
+	v.Check(facetSize <= 100, "facet_size", "must be a maximum of 100")
+
+	if slices.Contains(facets, "tags") {
+		input.TagFacets = facetSize
+	}
 
 	// Read the page and page_size query string values into the embedded struct.
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
-	// Read the sort query string value into the embedded struct.
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "content", "-id", "-title", "-content"}
+	// A cursor from the metadata of an earlier response continues from where that page
+	// ended, and is used instead of the page number.
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.CursorSecret = []byte(app.config.cursor.secret)
+
+	// Read the sort query string value into the embedded struct. Full-text searches
+	// show the most relevant snips first by default.
+	defaultSort := "id"
+	if input.Query.Text != "" {
+		defaultSort = "-rank"
+	}
+	input.Filters.Sort = app.readString(qs, "sort", defaultSort)
+	input.Filters.SortSafelist = []string{"id", "title", "content", "rank", "-id", "-title", "-content", "-rank"}
+
+	if input.Query.Text == "" {
+		v.Check(input.Filters.Sort != "rank" && input.Filters.Sort != "-rank", "sort", "rank can only be used when q contains search text")
+	}
 
 	// Execute the validation checks on the Filters struct and send a response
 	// containing the errors if necessary.
@@ -49,13 +76,93 @@ func (app *application) listSnipsHandler(w http.ResponseWriter, r *http.Request)
 
 	}
 
-	snips, metadata, err := app.models.Snips.GetAll(input.Title, input.Tags, input.Filters)
+	snips, metadata, facetCounts, err := app.models.Snips.GetAll(input.SnipSearch, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Let clients which already hold this exact page skip downloading it again.
+	if app.notModified(w, r, listETag(snips, metadata, facetCounts)) {
+		return
+	}
+
+	env := envelope{"snips": snips, "metadata": metadata}
+	if facetCounts != nil {
+		env["facets"] = facetCounts
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readSnipSearch reads the parameters which select snips, as accepted by the list and
+// export endpoints, from the query string.
+func (app *application) readSnipSearch(r *http.Request, qs url.Values, v *validator.Validator) data.SnipSearch {
+	var search data.SnipSearch
+
+	// The q parameter takes a search such as `tag:go -tag:deprecated retry`. Problems
+	// with individual terms are reported against their position in the search. The
+	// title and content parameters default to an empty string, which matches anything,
+	// and the comma separated tags parameter to an empty slice.
+	search.Query = data.ParseSearchQuery(v, "q", app.readString(qs, "q", ""))
+	search.Match = app.readString(qs, "match", data.MatchText)
+	search.Threshold = app.config.search.fuzzyThreshold
+	search.Title = app.readString(qs, "title", "")
+	search.Content = app.readString(qs, "content", "")
+	search.Tags = app.readCSV(qs, "tags", []string{})
+
+	// Tags are normalized when they're saved, so normalize the ones being searched for
+	// in the same way.
+	search.Tags = app.config.tags.Normalize(search.Tags)
+	search.Query.NormalizeTags(app.config.tags)
+
+	// The owner parameter restricts the results to snips owned by a single user. The
+	// special value "me" resolves to the authenticated caller.
+	switch owner := app.readString(qs, "owner", ""); owner {
+	case "":
+	case "me":
+		search.OwnerID = app.contextGetUser(r).ID
+	default:
+		id, err := strconv.ParseInt(owner, 10, 64)
+		if err != nil || id < 1 {
+			v.AddError("owner", `must be "me" or a positive integer user id`)
+		}
+		search.OwnerID = id
+	}
+
+	v.Check(validator.PermittedValue(search.Match, data.MatchText, data.MatchFuzzy), "match", `must be "text" or "fuzzy"`)
+
+	return search
+}
+
+// suggestSnipsHandler offers snip titles containing a prefix, for typeahead in editors.
+func (app *application) suggestSnipsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	prefix := app.readString(qs, "prefix", "")
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(prefix != "", "prefix", "must be provided")
+	v.Check(len(prefix) <= 100, "prefix", "must not be more than 100 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 50, "limit", "must be a maximum of 50")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.models.Snips.Suggest(prefix, limit)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"snips": snips, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -65,9 +172,11 @@ func (app *application) createSnipHandler(w http.ResponseWriter, r *http.Request
 	// Declare an anonymous struct to hold the information that we expect to be in the
 	// HTTP request body. This struct will be our *target decode destination*.
 	var input struct {
-		Title   string   `json:"title"`   // Snip title
-		Content string   `json:"content"` // Content of the snip
-		Tags    []string `json:"tags"`    // Slice of tags for the snip
+		Title     string         `json:"title"`     // Snip title
+		Slug      string         `json:"slug"`      // Optional unique name for includes
+		Content   string         `json:"content"`   // Content of the snip
+		Tags      []string       `json:"tags"`      // Slice of tags for the snip
+		Variables data.Variables `json:"variables"` // Variables to substitute when rendering
 	}
 
 	// Initialize a new json.Decoder instance which reads from the request body, and
@@ -78,11 +187,15 @@ func (app *application) createSnipHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Copy the values from the input struct into a new Snip struct.
+	// Copy the values from the input struct into a new Snip struct. The authenticated
+	// caller becomes the owner of the new snip, and the tags are normalized.
 	snip := &data.Snip{
-		Title:   input.Title,
-		Content: input.Content,
-		Tags:    input.Tags,
+		Title:     input.Title,
+		Slug:      input.Slug,
+		Content:   input.Content,
+		Tags:      app.config.tags.Normalize(input.Tags),
+		Variables: input.Variables,
+		OwnerID:   app.contextGetUser(r).ID,
 	}
 
 	// Init new Validator instance.
@@ -99,7 +212,13 @@ func (app *application) createSnipHandler(w http.ResponseWriter, r *http.Request
 	// snip struct with the system-generated information.
 	err = app.models.Snips.Insert(snip)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "a snip with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -109,6 +228,7 @@ func (app *application) createSnipHandler(w http.ResponseWriter, r *http.Request
 	// interpolating the system-generated ID for our new snip in the URL.
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/snips/%d", snip.ID))
+	headers.Set("ETag", snipETag(snip))
 
 	// Write a JSON response with a 201 Created status code, the snip data in the
 	// response body, and the Location header.
@@ -139,6 +259,12 @@ func (app *application) showSnipHandler(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
+
+	// Send a 304 Not Modified response if the client already has this version.
+	if app.notModified(w, r, snipETag(snip)) {
+		return
+	}
+
 	// Write the response, passing the envelope defined in helpers.go.
 	err = app.writeJSON(w, http.StatusOK, envelope{"snip": snip}, nil)
 	if err != nil {
@@ -167,44 +293,112 @@ func (app *application) updateSnipHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// If the request contains a X-Expected-Version header, verify that the movie
-	// version in the database matches the expected version specified in the header.
-	if r.Header.Get("X-Expected-Version") != "" {
-		if strconv.Itoa(int(snip.Version)) != r.Header.Get("X-Expected-Version") {
-			app.editConflictResponse(w, r)
-			return
-		}
+	// Only the owner of the snip (or an admin) is allowed to change it.
+	ok, err := app.canModifySnip(app.contextGetUser(r), snip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
-
-	// Declare an input struct to hold the expected data from the client.
-	var input struct {
-		Title   *string  `json:"title"`
-		Content *string  `json:"content"`
-		Tags    []string `json:"tags"`
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
 	}
 
-	// Read the JSON request body data into the input struct.
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	// If the request contains an If-Match or X-Expected-Version header, verify that
+	// the snip in the database is still the version the client expects.
+	if !app.checkPreconditions(w, r, snip) {
 		return
 	}
 
-	if input.Title != nil {
-		snip.Title = *input.Title
-	}
-	// We also do the same for the other fields in the input struct.
-	if input.Content != nil {
-		snip.Content = *input.Content
+	// The changes can be sent as a partial snip in plain JSON, as a JSON Merge Patch
+	// (RFC 7396), or as a JSON Patch (RFC 6902).
+	var (
+		edit        snipEdit
+		baseVersion *int32
+	)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "", "application/json":
+		// Declare an input struct to hold the expected data from the client.
+		// BaseVersion is optional, and names the version the client started editing
+		// from.
+		var input struct {
+			Title       *string         `json:"title"`
+			Slug        *string         `json:"slug"`
+			Content     *string         `json:"content"`
+			Tags        []string        `json:"tags"`
+			Variables   *data.Variables `json:"variables"`
+			BaseVersion *int32          `json:"base_version"`
+		}
+
+		// Read the JSON request body data into the input struct.
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		edit = snipEdit{Title: input.Title, Slug: input.Slug, Content: input.Content, Tags: input.Tags, Variables: input.Variables}
+		baseVersion = input.BaseVersion
+
+	case patch.MergePatchType, patch.JSONPatchType:
+		edit, err = app.readSnipPatch(w, r, snip, mediaType)
+		if err != nil {
+			switch {
+			// A failed "test" operation means the snip isn't in the state the client
+			// expected, which we treat like any other edit conflict.
+			case errors.Is(err, patch.ErrTestFailed):
+				app.editConflictResponse(w, r)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "application/json", patch.MergePatchType, patch.JSONPatchType)
+		return
 	}
-	if input.Tags != nil {
-		snip.Tags = input.Tags // Note that we don't need to dereference a slice.
+
+	v := validator.New()
+
+	// If the client edited an older version of the snip, merge their changes with the
+	// changes made since then instead of overwriting them. Otherwise the edited fields
+	// simply replace the current values.
+	if baseVersion != nil && *baseVersion != snip.Version {
+		v.Check(*baseVersion > 0, "base_version", "must be greater than zero")
+		v.Check(*baseVersion < snip.Version, "base_version", "must not be newer than the current version")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		base, err := app.models.Snips.GetVersion(snip.ID, *baseVersion)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("base_version", "no such version for this snip")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if conflict := mergeSnipEdit(base, snip, edit); conflict != nil {
+			app.mergeConflictResponse(w, r, conflict, snip)
+			return
+		}
+	} else {
+		applySnipEdit(snip, edit)
 	}
 
+	snip.Tags = app.config.tags.Normalize(snip.Tags)
+
 	// Validate the updated snip record, sending the client a 422 Unprocessable Entity
 	// response if any checks fail.
-	v := validator.New()
-
 	if data.ValidateSnip(v, snip); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -216,14 +410,20 @@ func (app *application) updateSnipHandler(w http.ResponseWriter, r *http.Request
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "a snip with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	// Write the updated snip record in a JSON response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"snip": snip}, nil)
+	// Write the updated snip record in a JSON response, along with its new ETag.
+	headers := make(http.Header)
+	headers.Set("ETag", snipETag(snip))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"snip": snip}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -237,13 +437,43 @@ func (app *application) deleteSnipHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Delete the snip from the database, sending a 404 Not Found response to the
-	// client if there isn't a matching record.
-	err = app.models.Snips.Delete(id)
+	// Fetch the existing snip record so that we can check who owns it.
+	snip, err := app.models.Snips.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only the owner of the snip (or an admin) is allowed to delete it.
+	ok, err := app.canModifySnip(app.contextGetUser(r), snip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	// Honor If-Match and X-Expected-Version in the same way as updates do.
+	if !app.checkPreconditions(w, r, snip) {
+		return
+	}
+
+	// Delete the snip from the database. The delete only goes ahead if the snip is
+	// still at the version we checked above, otherwise we send an edit conflict.
+	err = app.models.Snips.Delete(snip.ID, snip.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -251,8 +481,24 @@ func (app *application) deleteSnipHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// Return a 200 OK status code along with a success message.
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "snip successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "snip moved to trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// canModifySnip reports whether the user is allowed to update or delete the snip. Owners
+// can always modify their own snips, and holders of the snips:admin permission can
+// modify any snip, including legacy snips which have no owner.
+func (app *application) canModifySnip(user *data.User, snip *data.Snip) (bool, error) {
+	if !user.IsAnonymous() && snip.OwnerID == user.ID {
+		return true, nil
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include("snips:admin"), nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// listTagsHandler lists every tag in use, most used first by default.
+func (app *application) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-count")
+	input.Filters.SortSafelist = []string{"tag", "count", "-tag", "-count"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tags, metadata, err := app.models.Tags.GetAll(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tags": tags, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// renameTagHandler renames a tag on every snip which has it. Renaming a tag to one
+// which is already in use merges the two.
+func (app *application) renameTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag := r.PathValue("tag")
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// The new name is normalized like any other tag being saved. The current name is
+	// used as it is, as it has to match the tags already on the snips.
+	input.Name = app.config.tags.NormalizeTag(input.Name)
+
+	v := validator.New()
+
+	data.ValidateTag(v, "name", input.Name)
+	v.Check(input.Name != tag, "name", "must be different to the current name")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	updated, err := app.models.Tags.Replace([]string{tag}, input.Name)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Tags only exist on snips, so a tag no snip uses doesn't exist.
+	if updated == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": input.Name, "updated_snips": updated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeTagsHandler replaces several tags with a single one, for example to fold
+// "golang" and "Go" into "go".
+func (app *application) mergeTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Tags []string `json:"tags"`
+		Into string   `json:"into"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	input.Into = app.config.tags.NormalizeTag(input.Into)
+
+	v := validator.New()
+
+	v.Check(len(input.Tags) > 0, "tags", "must contain at least one tag")
+	v.Check(len(input.Tags) <= 100, "tags", "must not contain more than 100 tags")
+	v.Check(validator.Unique(input.Tags), "tags", "must not contain duplicate values")
+
+	for i, tag := range input.Tags {
+		data.ValidateTag(v, fmt.Sprintf("tags[%d]", i), tag)
+	}
+
+	data.ValidateTag(v, "into", input.Into)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	updated, err := app.models.Tags.Replace(input.Tags, input.Into)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": input.Into, "updated_snips": updated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTagHandler removes a tag from every snip which has it. The snips themselves are
+// kept.
+func (app *application) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	updated, err := app.models.Tags.Replace([]string{r.PathValue("tag")}, "")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if updated == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tag successfully deleted", "updated_snips": updated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTagSynonymsHandler lists every tag synonym.
+func (app *application) listTagSynonymsHandler(w http.ResponseWriter, r *http.Request) {
+	synonyms, err := app.models.Tags.GetSynonyms()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"synonyms": synonyms}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setTagSynonymHandler makes the tag in the URL a synonym of the tag in the request
+// body, so that searching for either finds snips with both.
+func (app *application) setTagSynonymHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Tag string `json:"tag"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	synonym := app.config.tags.NormalizeTag(r.PathValue("synonym"))
+	input.Tag = app.config.tags.NormalizeTag(input.Tag)
+
+	v := validator.New()
+
+	data.ValidateTag(v, "synonym", synonym)
+	data.ValidateTag(v, "tag", input.Tag)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stored, err := app.models.Tags.SetSynonym(synonym, input.Tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrSynonymChain):
+			v.AddError("tag", "must not be the synonym itself, and the synonym must not have synonyms of its own")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"synonym": stored}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTagSynonymHandler removes a tag synonym. Snips tagged with it are unchanged.
+func (app *application) deleteTagSynonymHandler(w http.ResponseWriter, r *http.Request) {
+	synonym := app.config.tags.NormalizeTag(r.PathValue("synonym"))
+
+	err := app.models.Tags.DeleteSynonym(synonym)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "synonym successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// listTrashHandler lists the snips in the trash. Users see the snips they own, and
+// holders of the snips:admin permission see every trashed snip.
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Show the most recently trashed snips first by default.
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ownerID := user.ID
+	if permissions.Include("snips:admin") {
+		ownerID = 0
+	}
+
+	snips, metadata, err := app.models.Snips.GetAllDeleted(ownerID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"snips": snips, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreSnipHandler takes a snip back out of the trash.
+func (app *application) restoreSnipHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Fetch the trashed snip, so that we can check who owns it.
+	snip, err := app.models.Snips.GetDeleted(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only the owner of the snip (or an admin) is allowed to restore it.
+	ok, err := app.canModifySnip(app.contextGetUser(r), snip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Snips.Restore(snip)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", snipETag(snip))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"snip": snip}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash permanently deletes snips which have been in the trash for longer than the
+// configured retention period. It runs once straight away, and then once every purge
+// interval until the server shuts down.
+func (app *application) purgeTrash() {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := app.models.Snips.Purge(time.Now().Add(-app.config.trash.retention))
+		if err != nil {
+			app.logger.Error(err.Error())
+		} else if purged > 0 {
+			app.logger.Info("purged trashed snips", "count", purged, "retention", app.config.trash.retention)
+		}
+
+		// Stop when the server shuts down, rather than waiting for the next tick.
+		select {
+		case <-ticker.C:
+		case <-app.shutdown:
+			return
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegisterUserRejectsPasswords(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{name: "missing", password: "", want: "must be provided"},
+		{name: "too short", password: "pa55", want: "must be at least 8 bytes long"},
+		{name: "too long", password: strings.Repeat("a", 73), want: "must not be more than 72 bytes long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The application has no models, so the handler must reject the password
+			// before it gets anywhere near the database.
+			app := &application{}
+
+			body, err := json.Marshal(map[string]string{
+				"name":     "Alice",
+				"email":    "alice@example.com",
+				"password": tt.password,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(string(body)))
+			app.registerUserHandler(rr, r)
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+
+			var resp struct {
+				Error map[string]string `json:"error"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.Error["password"]; got != tt.want {
+				t.Errorf("got password error %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
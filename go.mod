@@ -5,3 +5,5 @@ go 1.24.2
 require github.com/lib/pq v1.10.9
 
 require golang.org/x/time v0.11.0
+
+require golang.org/x/crypto v0.36.0
@@ -0,0 +1,144 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testSafelist = []string{"id", "title", "-title"}
+
+func testFilters(sort, cursor string) Filters {
+	return Filters{
+		Page:         1,
+		PageSize:     20,
+		Sort:         sort,
+		SortSafelist: testSafelist,
+		Cursor:       cursor,
+		CursorSecret: []byte("secret"),
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		id     int64
+		value  any
+		before bool
+		want   cursor
+	}{
+		{"by id", "id", 42, int64(42), false, cursor{Sort: "id", ID: 42}},
+		{"by title", "title", 7, "hello", false, cursor{Sort: "title", Value: "hello", ID: 7}},
+		{"backwards", "-title", 7, "hello", true, cursor{Sort: "-title", Value: "hello", ID: 7, Before: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testFilters(tt.sort, "").newCursor(tt.id, tt.value, tt.before)
+
+			c, ok, err := testFilters(tt.sort, s).cursor()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !ok {
+				t.Fatal("cursor not found")
+			}
+			if !reflect.DeepEqual(c, tt.want) {
+				t.Errorf("got %+v; want %+v", c, tt.want)
+			}
+		})
+	}
+}
+
+func TestCursorNotGiven(t *testing.T) {
+	_, ok, err := testFilters("id", "").cursor()
+	if ok || err != nil {
+		t.Errorf("got %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestCursorRejects(t *testing.T) {
+	valid := testFilters("title", "").newCursor(7, "hello", false)
+	payload, mac, _ := strings.Cut(valid, ".")
+
+	// A payload for a different position, signed with the wrong key.
+	forged := encodeCursor([]byte("other secret"), cursor{Sort: "title", Value: "a", ID: 1})
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"malformed", "title", "not a cursor"},
+		{"bad encoding", "title", "!!!." + mac},
+		{"missing signature", "title", payload},
+		{"empty signature", "title", payload + "."},
+		{"tampered signature", "title", payload + "." + strings.Repeat("A", len(mac))},
+		{"tampered payload", "title", forgedPayload + "." + mac},
+		{"other secret", "title", forged},
+		{"other sort", "-title", valid},
+		{"other sort column", "id", valid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok, err := testFilters(tt.sort, tt.cursor).cursor()
+			if !ok {
+				t.Error("cursor not found")
+			}
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got error %v; want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	tests := []struct {
+		name      string
+		sort      string
+		c         cursor
+		condition string
+		order     string
+		args      []any
+	}{
+		{
+			"by id", "id", cursor{Sort: "id", ID: 42},
+			"id > $2", "id ASC", []any{"q", int64(42)},
+		},
+		{
+			"by id backwards", "id", cursor{Sort: "id", ID: 42, Before: true},
+			"id < $2", "id DESC", []any{"q", int64(42)},
+		},
+		{
+			"by title", "title", cursor{Sort: "title", Value: "hello", ID: 7},
+			"(title > $3 OR (title = $3 AND id > $2))", "title ASC, id ASC", []any{"q", int64(7), "hello"},
+		},
+		{
+			"by title descending", "-title", cursor{Sort: "-title", Value: "hello", ID: 7},
+			"(title < $3 OR (title = $3 AND id > $2))", "title DESC, id ASC", []any{"q", int64(7), "hello"},
+		},
+		{
+			"by title descending backwards", "-title", cursor{Sort: "-title", Value: "hello", ID: 7, Before: true},
+			"(title > $3 OR (title = $3 AND id < $2))", "title ASC, id DESC", []any{"q", int64(7), "hello"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, order, args := testFilters(tt.sort, "").keyset(tt.c, []any{"q"})
+			if condition != tt.condition {
+				t.Errorf("got condition %q; want %q", condition, tt.condition)
+			}
+			if order != tt.order {
+				t.Errorf("got order %q; want %q", order, tt.order)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("got args %v; want %v", args, tt.args)
+			}
+		})
+	}
+}
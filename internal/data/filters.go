@@ -11,6 +11,8 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	Cursor       string // Opaque cursor from a previous page's metadata, used instead of Page
+	CursorSecret []byte // Key which cursors are signed with
 }
 
 func (f Filters) limit() int {
@@ -44,6 +46,36 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// cursor decodes the Cursor field. The second return value is false when no cursor was
+// given, and the page number should be used instead.
+func (f Filters) cursor() (cursor, bool, error) {
+	if f.Cursor == "" {
+		return cursor{}, false, nil
+	}
+
+	c, err := decodeCursor(f.CursorSecret, f.Cursor)
+	if err != nil {
+		return cursor{}, true, err
+	}
+
+	// The position a cursor holds only makes sense in the order it was issued for.
+	if c.Sort != f.Sort {
+		return cursor{}, true, ErrInvalidCursor
+	}
+
+	return c, true, nil
+}
+
+// newCursor returns a signed cursor for the record with the given id and sort column
+// value, continuing forwards from it or, if before is true, backwards.
+func (f Filters) newCursor(id int64, value any, before bool) string {
+	if f.sortColumn() == "id" {
+		value = nil
+	}
+
+	return encodeCursor(f.CursorSecret, cursor{Sort: f.Sort, Value: value, ID: id, Before: before})
+}
+
 func ValidateFilters(v *validator.Validator, f Filters) {
 	// Check that the page and page_size parameters contain sensible values.
 	v.Check(f.Page > 0, "page", "must be greater than zero")
@@ -53,15 +85,25 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 
 	// Check that the sort parameter matches a value in the safelist.
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	// A cursor already holds the position in the results, so it can't be combined with
+	// a page number.
+	if f.Cursor != "" {
+		_, _, err := f.cursor()
+		v.Check(err == nil, "cursor", "is invalid or was issued for a different sort order")
+		v.Check(f.Page == 1, "page", "must not be used with cursor")
+	}
 }
 
 // Define a new Metadata struct for holding the pagination metadata.
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 // The calculateMetadata() function calculates the appropriate pagination metadata
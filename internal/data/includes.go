@@ -0,0 +1,107 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// ErrDuplicateSlug is returned from Insert() and Update() when another snip already
+// has the slug.
+var ErrDuplicateSlug = errors.New("duplicate slug")
+
+// Slugs are lower case words separated by single hyphens, such as "license-header".
+var SlugRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ValidateSlug checks a snip slug. Slugs made only of digits aren't allowed, as they
+// couldn't be told apart from snip ids in includes.
+func ValidateSlug(v *validator.Validator, key, slug string) {
+	v.Check(len(slug) <= 100, key, "must not be more than 100 bytes long")
+	v.Check(validator.Matches(slug, SlugRX), key, "must contain only lower case letters, digits and single hyphens")
+	v.Check(strings.Trim(slug, "0123456789") != "", key, "must not contain only digits")
+}
+
+// A SnipRef identifies the snip an include refers to, by id or by slug, optionally
+// pinned to a specific version. A Version of 0 means the current version.
+type SnipRef struct {
+	ID      int64
+	Slug    string
+	Version int32
+}
+
+// ParseSnipRef parses a reference such as "42", "license" or "license@3".
+func ParseSnipRef(s string) (SnipRef, error) {
+	var ref SnipRef
+
+	name, version, pinned := strings.Cut(s, "@")
+	if pinned {
+		n, err := strconv.ParseInt(version, 10, 32)
+		if err != nil || n < 1 {
+			return SnipRef{}, fmt.Errorf("%q has an invalid version", s)
+		}
+		ref.Version = int32(n)
+	}
+
+	if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+		if id < 1 {
+			return SnipRef{}, fmt.Errorf("%q has an invalid id", s)
+		}
+		ref.ID = id
+		return ref, nil
+	}
+
+	if !validator.Matches(name, SlugRX) {
+		return SnipRef{}, fmt.Errorf("%q is not a snip id or slug", s)
+	}
+	ref.Slug = name
+
+	return ref, nil
+}
+
+// GetRef() returns the snip a reference refers to, as it was at the pinned version if
+// the reference has one. Only the fields needed to render the snip are filled in:
+// the id, slug, version, title, content and variables.
+func (m SnipModel) GetRef(ref SnipRef) (*Snip, error) {
+	// Older versions are read from snip_revisions, and the current version from the
+	// snips row itself. The slug always comes from the snips row, as slugs aren't
+	// versioned.
+	query := `
+        SELECT snips.id, COALESCE(snips.slug, ''), COALESCE(r.version, snips.version),
+            COALESCE(r.title, snips.title), COALESCE(r.content, snips.content), COALESCE(r.variables, snips.variables)
+        FROM snips
+        LEFT JOIN snip_revisions AS r ON r.snip_id = snips.id AND r.version = $3
+        WHERE (snips.id = $1 OR snips.slug = $2)
+        AND ($3 = 0 OR snips.version = $3 OR r.version IS NOT NULL)
+        AND snips.deleted_at IS NULL`
+
+	var snip Snip
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, ref.ID, ref.Slug, ref.Version).Scan(
+		&snip.ID,
+		&snip.Slug,
+		&snip.Version,
+		&snip.Title,
+		&snip.Content,
+		&snip.Variables,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &snip, nil
+}
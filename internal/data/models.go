@@ -12,16 +12,24 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
-// Create a Models struct which wraps the SnipModel. We'll add other models to this,
-// like a UserModel and PermissionModel, as our build progresses.
+// Create a Models struct which wraps the SnipModel, TagModel, UserModel, TokenModel
+// and PermissionModel.
 type Models struct {
-	Snips SnipModel
+	Permissions PermissionModel
+	Snips       SnipModel
+	Tags        TagModel
+	Tokens      TokenModel
+	Users       UserModel
 }
 
 // For ease of use, we also add a New() method which returns a Models struct containing
-// the initialized SnipModel.
+// the initialized models.
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Snips: SnipModel{DB: db},
+		Permissions: PermissionModel{DB: db},
+		Snips:       SnipModel{DB: db},
+		Tags:        TagModel{DB: db},
+		Tokens:      TokenModel{DB: db},
+		Users:       UserModel{DB: db},
 	}
 }
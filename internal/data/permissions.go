@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// Define a Permissions slice, which we will use to hold the permission codes (like
+// "snips:read" and "snips:write") for a single user.
+type Permissions []string
+
+// Add a helper method to check whether the Permissions slice contains a specific
+// permission code.
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// ValidatePermissionCodes checks a list of permission codes provided by a client.
+func ValidatePermissionCodes(v *validator.Validator, codes []string) {
+	v.Check(len(codes) >= 1, "codes", "must contain at least 1 permission code")
+	v.Check(len(codes) <= 20, "codes", "must not contain more than 20 permission codes")
+	v.Check(validator.Unique(codes), "codes", "must not contain duplicate values")
+
+	for _, code := range codes {
+		v.Check(code != "", "codes", "must not contain empty values")
+	}
+}
+
+// Define the PermissionModel type.
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+// The GetAllForUser() method returns all permission codes for a specific user in a
+// Permissions slice. The code in this method should feel very familiar --- it uses the
+// standard pattern that we've already seen before for retrieving multiple data rows in
+// an SQL query.
+func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	query := `
+        SELECT permissions.code
+        FROM permissions
+        INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+        INNER JOIN users ON users_permissions.user_id = users.id
+        WHERE users.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Add the provided permission codes for a specific user. Notice that we're using a
+// variadic parameter for the codes so that we can assign multiple permissions in a
+// single call. Codes which don't exist in the permissions table are ignored, as are
+// codes the user already holds.
+func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+	query := `
+        INSERT INTO users_permissions
+        SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+        ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+// Unknown returns the provided permission codes which don't exist in the permissions
+// table, in the order given.
+func (m PermissionModel) Unknown(codes ...string) ([]string, error) {
+	query := `
+        SELECT code
+        FROM unnest($1::text[]) WITH ORDINALITY AS given(code, position)
+        WHERE code NOT IN (SELECT permissions.code FROM permissions)
+        ORDER BY position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unknown []string
+
+	for rows.Next() {
+		var code string
+
+		err := rows.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+
+		unknown = append(unknown, code)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return unknown, nil
+}
+
+// Remove the provided permission codes from a specific user. Codes the user doesn't
+// hold are ignored.
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+        DELETE FROM users_permissions
+        USING permissions
+        WHERE users_permissions.permission_id = permissions.id
+        AND users_permissions.user_id = $1
+        AND permissions.code = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
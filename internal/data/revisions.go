@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A Revision holds the title, content, tags and variables of a snip as they were at a
+// specific version. ReplacedAt records when the version was superseded by a newer one, and is
+// nil for the current version of the snip.
+type Revision struct {
+	SnipID     int64      `json:"snip_id"`
+	Version    int32      `json:"version"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Variables  Variables  `json:"variables,omitempty"`
+	ReplacedAt *time.Time `json:"replaced_at,omitempty"`
+}
+
+// archiveRevision copies the snip row with the given id and version into the
+// snip_revisions table. It must be called inside the same transaction as the statement
+// which modifies the snip, so the history and the snip never disagree. If the snip is
+// no longer at the expected version (or another transaction has already archived that
+// version), ErrEditConflict is returned.
+func archiveRevision(ctx context.Context, tx *sql.Tx, id int64, version int32) error {
+	query := `
+        INSERT INTO snip_revisions (snip_id, version, title, content, tags, variables)
+        SELECT id, version, title, content, tags, variables
+        FROM snips
+        WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, id, version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "snip_revisions_pkey"`:
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// GetVersions() returns every version of a snip, newest first, including the current
+// one. Content is left out to keep the listing small; use GetVersion() to fetch it. The
+// history of a snip in the trash is hidden along with the snip itself.
+func (m SnipModel) GetVersions(id int64) ([]*Revision, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, version, title, tags, NULL::timestamptz
+        FROM snips
+        WHERE id = $1 AND deleted_at IS NULL
+        UNION ALL
+        SELECT snip_id, snip_revisions.version, snip_revisions.title, snip_revisions.tags, replaced_at
+        FROM snip_revisions
+        INNER JOIN snips ON snips.id = snip_revisions.snip_id
+        WHERE snip_id = $1 AND snips.deleted_at IS NULL
+        ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		var revision Revision
+
+		err := rows.Scan(
+			&revision.SnipID,
+			&revision.Version,
+			&revision.Title,
+			pq.Array(&revision.Tags),
+			&revision.ReplacedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The snips row is always part of the result, so an empty result means there is
+	// no such snip.
+	if len(revisions) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return revisions, nil
+}
+
+// GetVersion() returns a snip as it was at a specific version. The current version is
+// read from the snips table and older versions from snip_revisions.
+func (m SnipModel) GetVersion(id int64, version int32) (*Revision, error) {
+	if id < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, version, title, content, tags, variables, NULL::timestamptz
+        FROM snips
+        WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+        UNION ALL
+        SELECT snip_id, snip_revisions.version, snip_revisions.title, snip_revisions.content, snip_revisions.tags, snip_revisions.variables, replaced_at
+        FROM snip_revisions
+        INNER JOIN snips ON snips.id = snip_revisions.snip_id
+        WHERE snip_id = $1 AND snip_revisions.version = $2 AND snips.deleted_at IS NULL`
+
+	var revision Revision
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, version).Scan(
+		&revision.SnipID,
+		&revision.Version,
+		&revision.Title,
+		&revision.Content,
+		pq.Array(&revision.Tags),
+		&revision.Variables,
+		&revision.ReplacedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
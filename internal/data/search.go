@@ -0,0 +1,274 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// The maximum number of terms a search may contain, which keeps the generated SQL to a
+// sensible size.
+const maxSearchTerms = 20
+
+// A SearchQuery is a parsed search string, such as
+//
+//	tag:go tag:http -tag:deprecated title:"retry loop" created:>2026-01-01 backoff
+//
+// Qualified terms (field:value) filter on a single field, and a leading "-" negates
+// them. Everything else is left as Text and used for full-text search.
+type SearchQuery struct {
+	Text  string // The unqualified terms, in websearch_to_tsquery() syntax
+	terms []searchTerm
+}
+
+// searchTerm is a single qualified term. For created: terms, start holds the time
+// given, and end is set to the end of the day when only a date was given.
+type searchTerm struct {
+	field  string
+	op     string
+	value  string
+	start  time.Time
+	end    time.Time
+	negate bool
+}
+
+// searchFields are the qualifiers which may be used in a search.
+var searchFields = []string{"tag", "title", "content", "created"}
+
+// ParseSearchQuery parses a search string. Any problems are added to the validator
+// under keys like "q[12]", where key is "q" and 12 is the byte offset of the offending
+// term, so that clients can point at the exact part of the search which is wrong.
+func ParseSearchQuery(v *validator.Validator, key, input string) SearchQuery {
+	var query SearchQuery
+	var text []string
+
+	count := 0
+	for pos := 0; pos < len(input); {
+		// Skip the whitespace between terms.
+		if isSpace(input[pos]) {
+			pos++
+			continue
+		}
+
+		start := pos
+		errKey := fmt.Sprintf("%s[%d]", key, start)
+
+		raw, field, value, end, err := scanSearchTerm(input, pos)
+		pos = end
+
+		count++
+		if count > maxSearchTerms {
+			v.AddError(key, fmt.Sprintf("must not contain more than %d terms", maxSearchTerms))
+			break
+		}
+
+		if err != "" {
+			v.AddError(errKey, err)
+			continue
+		}
+
+		// Unqualified terms are passed through untouched, as websearch_to_tsquery()
+		// already understands quoted phrases, "or" and negation.
+		if field == "" {
+			text = append(text, raw)
+			continue
+		}
+
+		term := searchTerm{field: strings.ToLower(field), negate: strings.HasPrefix(raw, "-")}
+
+		if term.field == "created" {
+			term.op, value = splitOperator(value)
+		}
+
+		if value == "" {
+			v.AddError(errKey, fmt.Sprintf("%s: must have a value", term.field))
+			continue
+		}
+
+		switch term.field {
+		case "created":
+			t, dateOnly, ok := parseSearchTime(value)
+			if !ok {
+				v.AddError(errKey, "created: must be a date (2006-01-02) or an RFC 3339 timestamp")
+				continue
+			}
+			term.start = t
+			// A plain date covers the whole day, so created:2026-01-01 matches anything
+			// created on that day and created:>2026-01-01 starts at the day after.
+			if dateOnly {
+				term.end = t.AddDate(0, 0, 1)
+			}
+		default:
+			term.value = value
+		}
+
+		query.terms = append(query.terms, term)
+	}
+
+	query.Text = strings.Join(text, " ")
+
+	return query
+}
+
+// scanSearchTerm reads the term which starts at pos. It returns the raw text of the
+// term, the field and value if it is qualified, and the position just after it. Quoted
+// values may contain spaces. A non-empty error message is returned for malformed terms.
+func scanSearchTerm(input string, pos int) (raw, field, value string, end int, err string) {
+	start := pos
+
+	if input[pos] == '-' {
+		pos++
+	}
+
+	// A qualifier is one of the search fields followed by a colon. Anything else with a
+	// colon in it, such as std::vector or a URL, is plain text.
+	nameStart := pos
+	for pos < len(input) && isLetter(input[pos]) {
+		pos++
+	}
+	if pos < len(input) && input[pos] == ':' && validator.PermittedValue(strings.ToLower(input[nameStart:pos]), searchFields...) {
+		field = input[nameStart:pos]
+		pos++
+	} else {
+		pos = nameStart
+	}
+
+	valueStart := pos
+	for pos < len(input) && !isSpace(input[pos]) {
+		if input[pos] != '"' {
+			pos++
+			continue
+		}
+
+		// Skip over the quoted section, which may contain whitespace.
+		closing := strings.IndexByte(input[pos+1:], '"')
+		if closing < 0 {
+			return input[start:], field, "", len(input), "unterminated quoted string"
+		}
+		pos += closing + 2
+	}
+
+	value = input[valueStart:pos]
+	if field != "" {
+		value = strings.ReplaceAll(value, `"`, "")
+	}
+
+	return input[start:pos], field, value, pos, ""
+}
+
+// The search syntax is all ASCII, so terms are scanned byte by byte. These helpers
+// never match part of a multi-byte UTF-8 character.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f' || b == '\v'
+}
+
+func isLetter(b byte) bool {
+	return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// splitOperator splits a leading comparison operator off a value.
+func splitOperator(value string) (string, string) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, op) {
+			return op, value[len(op):]
+		}
+	}
+
+	return "=", value
+}
+
+// parseSearchTime parses a date (taken to be UTC) or an RFC 3339 timestamp.
+func parseSearchTime(value string) (time.Time, bool, bool) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, true
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, true
+	}
+
+	return time.Time{}, false, false
+}
+
+// NormalizeTags applies the tag rules to the values of tag: terms, so that they match
+// tags which were normalized when they were saved.
+func (q *SearchQuery) NormalizeTags(rules TagRules) {
+	for i := range q.terms {
+		if q.terms[i].field == "tag" {
+			q.terms[i].value = rules.NormalizeTag(q.terms[i].value)
+		}
+	}
+}
+
+// withTags returns a copy of the query with a tag: term added for each of the tags.
+func (q SearchQuery) withTags(tags []string) SearchQuery {
+	q.terms = slices.Clone(q.terms)
+
+	for _, tag := range tags {
+		q.terms = append(q.terms, searchTerm{field: "tag", value: tag})
+	}
+
+	return q
+}
+
+// predicate returns a SQL boolean expression matching the qualified terms of the
+// query, along with args extended with the values for its placeholders. Values are
+// always passed as parameters and never written into the SQL itself.
+func (q SearchQuery) predicate(args []any) (string, []any) {
+	if len(q.terms) == 0 {
+		return "TRUE", args
+	}
+
+	param := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := make([]string, 0, len(q.terms))
+
+	for _, term := range q.terms {
+		var condition string
+
+		switch term.field {
+		case "tag":
+			// Tags match their synonyms too, so tag:golang finds snips tagged go.
+			condition = fmt.Sprintf("tags && tag_synonym_group(%s::text)", param(term.value))
+		case "title", "content":
+			condition = fmt.Sprintf("to_tsvector('simple', %s) @@ phraseto_tsquery('simple', %s)", term.field, param(term.value))
+		case "created":
+			condition = createdCondition(term, param)
+		}
+
+		if term.negate {
+			condition = "NOT (" + condition + ")"
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	return "(" + strings.Join(conditions, " AND ") + ")", args
+}
+
+// createdCondition builds the condition for a created: term. Terms with a plain date
+// compare against the whole day, terms with a timestamp against that exact instant.
+func createdCondition(term searchTerm, param func(any) string) string {
+	if term.end.IsZero() {
+		return fmt.Sprintf("created_at %s %s::timestamptz", term.op, param(term.start))
+	}
+
+	switch term.op {
+	case ">":
+		return fmt.Sprintf("created_at >= %s::timestamptz", param(term.end))
+	case ">=":
+		return fmt.Sprintf("created_at >= %s::timestamptz", param(term.start))
+	case "<":
+		return fmt.Sprintf("created_at < %s::timestamptz", param(term.start))
+	case "<=":
+		return fmt.Sprintf("created_at < %s::timestamptz", param(term.end))
+	default:
+		return fmt.Sprintf("(created_at >= %s::timestamptz AND created_at < %s::timestamptz)", param(term.start), param(term.end))
+	}
+}
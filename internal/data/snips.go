@@ -3,21 +3,30 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/pwilliams-ck/sniplate/internal/render"
 	"github.com/pwilliams-ck/sniplate/internal/validator"
 )
 
 type Snip struct {
-	ID        int64     `json:"id"`                // Unique integer ID for the snip
-	CreatedAt time.Time `json:"created_at"`        // Timestamp for when the snip is added to our database
-	Title     string    `json:"title"`             // Snip title
-	Content   string    `json:"content,omitempty"` // Content of the snip
-	Tags      []string  `json:"tags,omitempty"`    // Slice of tags for the snip
-	Version   int32     `json:"version"`           // Starts at 1 and increments each time the snip is updated
+	ID        int64      `json:"id"`                   // Unique integer ID for the snip
+	CreatedAt time.Time  `json:"created_at"`           // Timestamp for when the snip is added to our database
+	Title     string     `json:"title"`                // Snip title
+	Slug      string     `json:"slug,omitempty"`       // Unique name other snips can include the snip by
+	Content   string     `json:"content,omitempty"`    // Content of the snip
+	Tags      []string   `json:"tags,omitempty"`       // Slice of tags for the snip
+	Variables Variables  `json:"variables,omitempty"`  // Variables substituted into the content when it is rendered
+	OwnerID   int64      `json:"owner_id,omitempty"`   // ID of the user who created the snip, 0 if unowned
+	Version   int32      `json:"version"`              // Starts at 1 and increments each time the snip is updated
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // When the snip was moved to the trash, nil if it isn't trashed
+	Highlight string     `json:"highlight,omitempty"`  // Matching fragments of the content as escaped HTML, only set by full-text searches
+	Score     float64    `json:"score,omitempty"`      // How closely the title matches, only set by fuzzy searches
 }
 
 func ValidateSnip(v *validator.Validator, snip *Snip) {
@@ -38,6 +47,31 @@ func ValidateSnip(v *validator.Validator, snip *Snip) {
 	for _, tag := range snip.Tags {
 		v.Check(tag != "", "tags", "tags must not contain empty values")
 	}
+
+	// The slug is optional, but other snips can only include this one by slug if it
+	// has one.
+	if snip.Slug != "" {
+		ValidateSlug(v, "slug", snip.Slug)
+	}
+
+	// Snips which declare variables are templates, so their content has to be a valid
+	// sandboxed template, and anything it includes has to be a valid reference.
+	ValidateVariables(v, snip.Variables)
+
+	if len(snip.Variables) > 0 {
+		tmpl, err := render.Parse("content", snip.Content, nil)
+		if err != nil {
+			v.AddError("content", "must be a valid template: "+err.Error())
+			return
+		}
+
+		for _, ref := range render.Includes(tmpl) {
+			_, err := ParseSnipRef(ref)
+			if err != nil {
+				v.AddError("content", "must only include valid snip references: "+err.Error())
+			}
+		}
+	}
 }
 
 // Define a SnipModel struct type which wraps a sql.DB connection pool.
@@ -51,14 +85,14 @@ func (m SnipModel) Insert(snip *Snip) error {
 	// Define the SQL query for inserting a new record in the snips table and returning
 	// the system-generated data.
 	query := `
-        INSERT INTO snips (title, content, tags)
-        VALUES ($1, $2, $3)
+        INSERT INTO snips (title, content, tags, owner_id, variables, slug)
+        VALUES ($1, $2, $3, NULLIF($4, 0), $5, NULLIF($6, ''))
         RETURNING id, created_at, version`
 
 	// Create an args slice containing the values for the placeholder parameters from
 	// the snip struct. Declaring this slice immediately next to our SQL query helps to
 	// make it nice and clear *what values are being used where* in the query.
-	args := []any{snip.Title, snip.Content, pq.Array(snip.Tags)}
+	args := []any{snip.Title, snip.Content, pq.Array(snip.Tags), snip.OwnerID, snip.Variables, snip.Slug}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -66,7 +100,17 @@ func (m SnipModel) Insert(snip *Snip) error {
 	// Use the QueryRow() method to execute the SQL query on our connection pool,
 	// passing in the args slice as a variadic parameter and scanning the system-
 	// generated id, created_at and version values into the snip struct.
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&snip.ID, &snip.CreatedAt, &snip.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&snip.ID, &snip.CreatedAt, &snip.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "snips_slug_key"`:
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (m SnipModel) Get(id int64) (*Snip, error) {
@@ -80,9 +124,9 @@ func (m SnipModel) Get(id int64) (*Snip, error) {
 
 	// Define the SQL query for retrieving the snip data.
 	query := `
-        SELECT id, created_at, title, content, tags, version
+        SELECT id, created_at, title, content, tags, COALESCE(owner_id, 0), version, variables, COALESCE(slug, '')
         FROM snips
-        WHERE id = $1`
+        WHERE id = $1 AND deleted_at IS NULL`
 
 	// Declare a Snip struct to hold the data returned by the query.
 	var snip Snip
@@ -100,7 +144,10 @@ func (m SnipModel) Get(id int64) (*Snip, error) {
 		&snip.Title,
 		&snip.Content,
 		pq.Array(&snip.Tags),
+		&snip.OwnerID,
 		&snip.Version,
+		&snip.Variables,
+		&snip.Slug,
 	)
 	// Handle any errors. If there was no matching snip found, Scan() will return
 	// a sql.ErrNoRows error. We check for this and return our custom ErrRecordNotFound
@@ -118,33 +165,170 @@ func (m SnipModel) Get(id int64) (*Snip, error) {
 	return &snip, nil
 }
 
-// GetAll() returns a slice of snips. Although we're not
-// using them right now, we've set this up to accept the
-// various filter parameters as arguments.
-func (m SnipModel) GetAll(title string, tags []string, filters Filters) ([]*Snip, Metadata, error) {
-	// Construct the SQL query to retrieve all snip records.
-	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), id, created_at, title, content, tags, version
-        FROM snips
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-        AND (tags @> $2 OR $2 = '{}')
-        ORDER BY %s %s, id ASC
-        LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+// The ways the text of a search can be matched. MatchText is a full-text search across
+// the title, tags and content, and MatchFuzzy a typo-tolerant trigram search of the
+// title alone.
+const (
+	MatchText  = "text"
+	MatchFuzzy = "fuzzy"
+)
+
+// SnipSearch holds the criteria GetAll() matches snips against. Empty fields match
+// every snip.
+type SnipSearch struct {
+	Query     SearchQuery // Parsed search, whose text is matched according to Match
+	Match     string      // MatchText or MatchFuzzy, defaults to MatchText
+	Threshold float64     // Minimum word similarity (0 to 1) for fuzzy matches
+	Title     string      // Words which must appear in the title
+	Content   string      // Words which must appear in the content
+	Tags      []string    // Tags the snip must have, all of them
+	OwnerID   int64       // Owner of the snip, 0 for any owner
+	TagFacets int         // How many of the most used tags to count, 0 for none
+}
+
+// Facets summarise every snip matching a search, not just those on the current page.
+type Facets struct {
+	Tags []TagCount `json:"tags"` // The most used tags, most used first
+}
+
+// Options for ts_headline(). Matches are wrapped in <mark> tags.
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=20, MinWords=5, FragmentDelimiter=" ... "`
+
+// headlineContent escapes the HTML special characters in the content before it's
+// passed to ts_headline(), so the only markup in a highlight is the <mark> tags it
+// adds, and clients can show it as HTML as is. The ampersand has to go first, or the
+// other replacements would be escaped twice. The escapes are read as single entity
+// tokens, so they don't change which words match.
+const headlineContent = `replace(replace(replace(replace(content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;')`
+
+// GetAll() returns a slice of snips matching the search criteria. When the search has
+// text, the results can be sorted by relevance using the "rank" sort column, and each
+// snip also gets a highlight of the matching parts of its content (for full-text
+// searches) or a similarity score (for fuzzy searches). Pages are selected by the
+// cursor in filters if there is one, and by page number otherwise. Facets are only
+// returned if search.TagFacets asks for them.
+func (m SnipModel) GetAll(search SnipSearch, filters Filters) ([]*Snip, Metadata, *Facets, error) {
+	c, useCursor, err := filters.cursor()
+	if err != nil {
+		return nil, Metadata{}, nil, err
+	}
+
+	args := []any{
+		search.Query.Text,
+		search.Title,
+		search.Content,
+		search.OwnerID,
+	}
+
+	// Add the conditions for any qualified search terms, such as tag:go or
+	// created:>2026-01-01, which take their placeholders from $5 onwards. The tags
+	// parameter works just like a tag: term for each of its tags, so that both match
+	// synonyms.
+	predicate, args := search.Query.withTags(search.Tags).predicate(args)
+
+	// Tag facets are counted across the whole of the matches CTE, in the same query as
+	// the total, and come back as a JSON array on every row. Their placeholder comes
+	// before the page's, so the summary query below can leave those off.
+	facets := "NULL::json"
+	if search.TagFacets > 0 {
+		args = append(args, search.TagFacets)
+		facets = fmt.Sprintf(`(
+            SELECT COALESCE(json_agg(json_build_object('tag', tag, 'count', n) ORDER BY n DESC, tag), '[]')
+            FROM (
+                SELECT tag, count(*) AS n
+                FROM matches, unnest(matches.tags) AS tag
+                GROUP BY tag
+                ORDER BY n DESC, tag
+                LIMIT $%d
+            ) AS counts
+        )`, len(args))
+	}
+
+	summaryArgs := len(args)
+
+	// Page numbers skip over rows with OFFSET. Cursors instead pick up straight after
+	// (or before) the row they point at, which stays fast however deep the page is and
+	// doesn't skip or repeat rows when snips are added or removed in between. One row
+	// more than a page is fetched so we can tell whether there's another page after it.
+	position := "TRUE"
+	order := fmt.Sprintf("%s %s, id ASC", filters.sortColumn(), filters.sortDirection())
+	limit, offset := filters.limit(), filters.offset()
+
+	if useCursor {
+		position, order, args = filters.keyset(c, args)
+		limit, offset = filters.limit()+1, 0
+	}
+
+	args = append(args, limit, offset)
+
+	// Full-text searches rank and highlight with the weighted search vector. Fuzzy
+	// searches use the <% operator, which can use the trigram index on title, and rank
+	// by word similarity instead.
+	match := "search @@ websearch_to_tsquery('simple', $1)"
+	rank := "ts_rank_cd(search, websearch_to_tsquery('simple', $1))"
+	highlight := fmt.Sprintf("ts_headline('simple', %s, websearch_to_tsquery('simple', $1), '%s')", headlineContent, headlineOptions)
+
+	if search.Match == MatchFuzzy {
+		match = "$1 <% title"
+		rank = "word_similarity($1, title)"
+		highlight = "''"
+	}
+
+	// Construct the SQL query to retrieve all snip records. The matches CTE finds
+	// every matching snip, so the total is counted across all of them whichever page
+	// is picked. The page CTE then picks out the page, and the final query builds the
+	// highlights, so that ts_headline(), which is relatively slow, only runs for the
+	// snips on the page.
+	matches := fmt.Sprintf(`
+        WITH matches AS (
+            SELECT id, created_at, title, content, tags, COALESCE(owner_id, 0) AS owner_id, version, variables, COALESCE(slug, '') AS slug,
+                CASE WHEN $1 = '' THEN 0 ELSE %s END AS rank
+            FROM snips
+            WHERE (%s OR $1 = '')
+            AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR $2 = '')
+            AND (to_tsvector('simple', content) @@ plainto_tsquery('simple', $3) OR $3 = '')
+            AND (owner_id = $4 OR $4 = 0)
+            AND %s
+            AND deleted_at IS NULL
+        )`, rank, match, predicate)
+
+	query := fmt.Sprintf(`%s, page AS (
+            SELECT * FROM matches
+            WHERE %s
+            ORDER BY %s
+            LIMIT $%d OFFSET $%d
+        )
+        SELECT (SELECT count(*) FROM matches), %s, id, created_at, title, content, tags, owner_id, version, variables, slug, rank,
+            CASE WHEN $1 = '' THEN '' ELSE %s END
+        FROM page
+        ORDER BY %s %s, id ASC`,
+		matches, position, order, len(args)-1, len(args),
+		facets, highlight, filters.sortColumn(), filters.sortDirection())
 
 	// Create a context with a 3-second timeout.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// As our SQL query now has quite a few placeholder parameters, let's collect the
-	// values for the placeholders in a slice. Notice here how we call the limit() and
-	// offset() methods on the Filters struct to get the appropriate values for the
-	// LIMIT and OFFSET clauses.
-	args := []any{title, pq.Array(tags), filters.limit(), filters.offset()}
+	// The <% operator compares against the pg_trgm.word_similarity_threshold setting
+	// rather than taking a threshold argument, so run the query in a transaction which
+	// sets it locally. The deferred Rollback() ends the read-only transaction.
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, Metadata{}, nil, err
+	}
+	defer tx.Rollback()
+
+	if search.Match == MatchFuzzy {
+		_, err = tx.ExecContext(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`, strconv.FormatFloat(search.Threshold, 'f', -1, 64))
+		if err != nil {
+			return nil, Metadata{}, nil, err
+		}
+	}
 
 	// And then pass the args slice to QueryContext() as a variadic parameter.
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := tx.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, nil, err
 	}
 
 	// Importantly, defer a call to rows.Close() to ensure that the resultset is closed
@@ -152,43 +336,132 @@ func (m SnipModel) GetAll(title string, tags []string, filters Filters) ([]*Snip
 	defer rows.Close()
 
 	totalRecords := 0
-	// Initialize an empty slice to hold the snip data.
+	var facetsJSON []byte
+	// Initialize an empty slice to hold the snip data, and the rank of each snip, which
+	// cursors need when sorting by rank.
 	snips := []*Snip{}
+	ranks := []float64{}
 
 	// Use rows.Next to iterate through the rows in the resultset.
 	for rows.Next() {
 		// Initialize an empty Snip struct to hold the data for an individual snip.
 		var snip Snip
+		var rank float64
 
 		// Scan the values from the row into the Snip struct. Again, note that we're
 		// using the pq.Array() adapter on the genres field here.
 		err := rows.Scan(
 			&totalRecords,
+			&facetsJSON,
 			&snip.ID,
 			&snip.CreatedAt,
 			&snip.Title,
 			&snip.Content,
 			pq.Array(&snip.Tags),
+			&snip.OwnerID,
 			&snip.Version,
+			&snip.Variables,
+			&snip.Slug,
+			&rank,
+			&snip.Highlight,
 		)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, Metadata{}, nil, err
+		}
+
+		// Full-text ranks aren't on any fixed scale, so they're only used for sorting,
+		// but fuzzy similarities run from 0 to 1 and make a useful score.
+		if search.Match == MatchFuzzy {
+			snip.Score = rank
 		}
 
 		// Add the Snip struct to the slice.
 		snips = append(snips, &snip)
+		ranks = append(ranks, rank)
 	}
 
 	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error
 	// that was encountered during the iteration.
 	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, nil, err
+	}
+
+	// An empty page, such as one past the end, has no rows to carry the total and the
+	// facets, so count them across the matches on their own.
+	if len(snips) == 0 {
+		rows.Close()
+
+		summary := fmt.Sprintf(`%s SELECT (SELECT count(*) FROM matches), %s`, matches, facets)
+
+		err = tx.QueryRowContext(ctx, summary, args[:summaryArgs]...).Scan(&totalRecords, &facetsJSON)
+		if err != nil {
+			return nil, Metadata{}, nil, err
+		}
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	// Sorting by content would put whole snips in the cursors, so cursors are only
+	// offered for the other sort columns.
+	cursorable := filters.sortColumn() != "content"
+
+	sortValue := func(i int) any {
+		switch filters.sortColumn() {
+		case "title":
+			return snips[i].Title
+		case "rank":
+			return ranks[i]
+		default:
+			return nil
+		}
+	}
+
+	var metadata Metadata
+	var hasNext, hasPrev bool
+
+	if useCursor {
+		// Drop the extra row, which sits at the far end of the page from the cursor.
+		more := len(snips) > filters.PageSize
+		if more && c.Before {
+			snips, ranks = snips[1:], ranks[1:]
+		} else if more {
+			snips, ranks = snips[:filters.PageSize], ranks[:filters.PageSize]
+		}
+
+		// Whichever way we came from, there's a page back that way.
+		hasNext = more || c.Before
+		hasPrev = more || !c.Before
+
+		metadata = Metadata{PageSize: filters.PageSize, TotalRecords: totalRecords}
+	} else {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+		hasNext = filters.Page < metadata.LastPage
+		hasPrev = filters.Page > 1
+	}
+
+	if cursorable && len(snips) > 0 {
+		if hasNext {
+			last := len(snips) - 1
+			metadata.NextCursor = filters.newCursor(snips[last].ID, sortValue(last), false)
+		}
+		if hasPrev {
+			metadata.PrevCursor = filters.newCursor(snips[0].ID, sortValue(0), true)
+		}
+	}
+
+	var result *Facets
+	if search.TagFacets > 0 {
+		result = &Facets{Tags: []TagCount{}}
+
+		if facetsJSON != nil {
+			err = json.Unmarshal(facetsJSON, &result.Tags)
+			if err != nil {
+				return nil, Metadata{}, nil, err
+			}
+		}
+	}
 
 	// If everything went OK, then return the slice of snips.
-	return snips, metadata, nil
+	return snips, metadata, result, nil
 }
 
 func (m SnipModel) Update(snip *Snip) error {
@@ -196,8 +469,8 @@ func (m SnipModel) Update(snip *Snip) error {
 	// number.
 	query := `
         UPDATE snips
-        SET title = $1, content = $2, tags = $3, version = version + 1
-        WHERE id = $4 AND version = $5
+        SET title = $1, content = $2, tags = $3, variables = $4, slug = NULLIF($5, ''), version = version + 1
+        WHERE id = $6 AND version = $7 AND deleted_at IS NULL
         RETURNING version`
 
 	// Create an args slice containing the values for the placeholder parameters.
@@ -205,6 +478,8 @@ func (m SnipModel) Update(snip *Snip) error {
 		snip.Title,
 		snip.Content,
 		pq.Array(snip.Tags),
+		snip.Variables,
+		snip.Slug,
 		snip.ID,
 		snip.Version,
 	}
@@ -212,37 +487,59 @@ func (m SnipModel) Update(snip *Snip) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&snip.Version)
+	// Copying the current row into snip_revisions and updating it happen in the same
+	// transaction, so a version is never lost or recorded twice. The deferred Rollback()
+	// is a no-op once the transaction has been committed.
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = archiveRevision(ctx, tx, snip.ID, snip.Version)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&snip.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "snips_slug_key"`:
+			return ErrDuplicateSlug
 		default:
 			return err
 		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (m SnipModel) Delete(id int64) error {
+// Delete() moves the snip with the given id to the trash, but only while it is still
+// at the given version. If the snip has been updated since the caller read it, an
+// ErrEditConflict error is returned and nothing is deleted. Trashed snips are hidden
+// from Get() and GetAll(), and can be brought back with Restore() until they are
+// purged.
+func (m SnipModel) Delete(id int64, version int32) error {
 	// Return an ErrRecordNotFound error if the snip ID is less than 1.
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	// Construct the SQL query to delete the record.
+	// Construct the SQL query to move the record to the trash.
 	query := `
-        DELETE FROM snips
-        WHERE id = $1`
+        UPDATE snips
+        SET deleted_at = NOW()
+        WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Execute the SQL query using the Exec() method, passing in the id variable as
-	// the value for the placeholder parameter. The Exec() method returns a sql.Result
-	// object.
-	result, err := m.DB.ExecContext(ctx, query, id)
+	// Execute the SQL query using the Exec() method, passing in the id and version
+	// variables as the values for the placeholder parameters. The Exec() method
+	// returns a sql.Result object.
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -254,10 +551,21 @@ func (m SnipModel) Delete(id int64) error {
 		return err
 	}
 
-	// If no rows were affected, we know that the snips table didn't contain a record
-	// with the provided ID at the moment we tried to delete it. In that case we
-	// return an ErrRecordNotFound error.
+	// If no rows were affected, either the snips table didn't contain a live record
+	// with the provided ID at the moment we tried to delete it, or the record has moved
+	// on to a newer version. Check which, so we can return ErrRecordNotFound or
+	// ErrEditConflict accordingly.
 	if rowsAffected == 0 {
+		var exists bool
+
+		err := m.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM snips WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return ErrEditConflict
+		}
 		return ErrRecordNotFound
 	}
 
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// A Suggestion is a snip title offered while the user is typing.
+type Suggestion struct {
+	ID    int64   `json:"id"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+// Suggest() returns up to limit snips whose title contains the prefix, for typeahead.
+// Titles which start with the prefix come first, then titles with a word starting with
+// it, then the rest by word similarity.
+func (m SnipModel) Suggest(prefix string, limit int) ([]*Suggestion, error) {
+	// The prefix is matched literally, so escape the LIKE wildcards.
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+
+	// ILIKE with a pattern of three or more characters can use the trigram index on
+	// title.
+	query := `
+        SELECT id, title, word_similarity($1, title) AS score
+        FROM snips
+        WHERE title ILIKE '%' || $2 || '%'
+        AND deleted_at IS NULL
+        ORDER BY title ILIKE $2 || '%' DESC, title ~* ('\m' || $3) DESC, score DESC, title ASC, id ASC
+        LIMIT $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, prefix, pattern, regexpQuote(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+
+	for rows.Next() {
+		var suggestion Suggestion
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Score)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// regexpQuote escapes the characters which are special in PostgreSQL regular
+// expressions.
+func regexpQuote(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		if strings.ContainsRune(`\.+*?()|[]{}^$`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
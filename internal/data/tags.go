@@ -0,0 +1,399 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// ErrSynonymChain is returned when a synonym would stand for itself, or when a tag
+// which has synonyms of its own would become a synonym.
+var ErrSynonymChain = errors.New("synonyms cannot be chained")
+
+// A TagCount is the number of snips which have a tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TagRules controls how tags are normalized before they're saved or searched for, so
+// that "Go", " go " and "go" all end up as the same tag.
+type TagRules struct {
+	Trim      bool // Remove leading and trailing whitespace
+	Lowercase bool // Convert to lower case
+	Slugify   bool // Replace each run of characters other than letters and digits with "-"
+	MaxLength int  // Truncate to this many characters, 0 for no limit
+}
+
+// Normalize applies the rules to each tag in turn, and drops any tags which become
+// duplicates of an earlier one. Tags which end up empty are kept, so that validation
+// can report them.
+func (r TagRules) Normalize(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = r.NormalizeTag(tag)
+
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized
+}
+
+// NormalizeTag applies the rules to a single tag.
+func (r TagRules) NormalizeTag(tag string) string {
+	if r.Trim {
+		tag = strings.TrimSpace(tag)
+	}
+
+	if r.Lowercase {
+		tag = strings.ToLower(tag)
+	}
+
+	if r.Slugify {
+		tag = slugify(tag)
+	}
+
+	if r.MaxLength > 0 && utf8.RuneCountInString(tag) > r.MaxLength {
+		tag = string([]rune(tag)[:r.MaxLength])
+
+		// Don't leave a dangling separator where the slug was cut short.
+		if r.Slugify {
+			tag = strings.TrimRight(tag, "-")
+		}
+	}
+
+	return tag
+}
+
+// slugify replaces every run of characters other than letters and digits with a single
+// "-", and trims any from the ends.
+func slugify(s string) string {
+	var b strings.Builder
+	separate := false
+
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			separate = b.Len() > 0
+			continue
+		}
+
+		if separate {
+			b.WriteByte('-')
+			separate = false
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// ValidateTag checks a single tag name, such as the target of a rename.
+func ValidateTag(v *validator.Validator, key, tag string) {
+	v.Check(tag != "", key, "must be provided")
+	v.Check(len(tag) <= 100, key, "must not be more than 100 bytes long")
+}
+
+// TagModel manages tags across every snip. Tags aren't stored separately, they only
+// exist in the tags column of the snips which use them.
+type TagModel struct {
+	DB *sql.DB
+}
+
+// GetAll() returns every tag in use by a snip outside the trash, with the number of
+// snips using it.
+func (m TagModel) GetAll(filters Filters) ([]TagCount, Metadata, error) {
+	// The window count is also named count, so the number of snips using each tag is
+	// called uses, and the count sort key maps to it.
+	column := filters.sortColumn()
+	if column == "count" {
+		column = "uses"
+	}
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER() AS total, tag, count(*) AS uses
+        FROM snips, unnest(snips.tags) AS tag
+        WHERE deleted_at IS NULL
+        GROUP BY tag
+        ORDER BY %s %s, tag ASC
+        LIMIT $1 OFFSET $2`, column, filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	tags := []TagCount{}
+
+	for rows.Next() {
+		var tag TagCount
+
+		err := rows.Scan(&totalRecords, &tag.Tag, &tag.Count)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return tags, metadata, nil
+}
+
+// Replace() replaces the source tags with the target tag on every snip outside the
+// trash, keeping the position of the first of them and dropping any duplicates that
+// leaves behind. An empty target removes the source tags instead. It returns the
+// number of snips changed.
+//
+// Every changed snip has its previous version recorded and its version number bumped,
+// exactly as if it had been updated by hand, so that clients holding an older version
+// get an edit conflict rather than silently undoing the change.
+func (m TagModel) Replace(sources []string, target string) (int64, error) {
+	// Rewriting thousands of snips can take a while, so allow more than the usual 3
+	// seconds.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the affected snips first, so that the revisions and the updates below see
+	// exactly the same set of rows, even if snips are tagged in the meantime.
+	query := `
+        SELECT id
+        FROM snips
+        WHERE tags && $1 AND deleted_at IS NULL
+        FOR UPDATE`
+
+	var ids []int64
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(sources))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	query = `
+        INSERT INTO snip_revisions (snip_id, version, title, content, tags, variables)
+        SELECT id, version, title, content, tags, variables
+        FROM snips
+        WHERE id = ANY($1)`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	// A NULL target maps the source tags to NULL, which is then filtered out along with
+	// the duplicates.
+	var replacement any
+	if target != "" {
+		replacement = target
+	}
+
+	query = `
+        UPDATE snips
+        SET tags = ARRAY(
+            SELECT tag
+            FROM (
+                SELECT DISTINCT ON (tag) tag, ord
+                FROM (
+                    SELECT CASE WHEN tag = ANY($2) THEN $3::text ELSE tag END AS tag, ord
+                    FROM unnest(snips.tags) WITH ORDINALITY AS t(tag, ord)
+                ) AS replaced
+                WHERE tag IS NOT NULL
+                ORDER BY tag, ord
+            ) AS deduplicated
+            ORDER BY ord
+        ), version = version + 1
+        WHERE id = ANY($1)`
+
+	result, err := tx.ExecContext(ctx, query, pq.Array(ids), pq.Array(sources), replacement)
+	if err != nil {
+		return 0, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, tx.Commit()
+}
+
+// A Synonym is an alternative name for a tag. Searching for the synonym also finds
+// snips with the tag, and vice versa.
+type Synonym struct {
+	Synonym string `json:"synonym"`
+	Tag     string `json:"tag"`
+}
+
+// GetSynonyms() returns every synonym, grouped by the tag they stand for.
+func (m TagModel) GetSynonyms() ([]Synonym, error) {
+	query := `
+        SELECT synonym, tag
+        FROM tag_synonyms
+        ORDER BY tag, synonym`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	synonyms := []Synonym{}
+
+	for rows.Next() {
+		var synonym Synonym
+
+		err := rows.Scan(&synonym.Synonym, &synonym.Tag)
+		if err != nil {
+			return nil, err
+		}
+
+		synonyms = append(synonyms, synonym)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return synonyms, nil
+}
+
+// SetSynonym() makes one tag a synonym of another, replacing whatever it was a synonym
+// of before. Synonyms only go one level deep, so if the tag is itself a synonym the new
+// synonym points at the tag it stands for instead, and a tag which already has
+// synonyms can't become a synonym itself. The stored synonym is returned.
+func (m TagModel) SetSynonym(synonym, tag string) (*Synonym, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the table against other writers until the transaction ends, so two synonyms
+	// set at the same time can't each pass the checks below against the state before
+	// the other, and build a chain between them. The lock mode conflicts with itself,
+	// but not with the plain reads which searches make.
+	_, err = tx.ExecContext(ctx, `LOCK TABLE tag_synonyms IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT COALESCE((SELECT tag FROM tag_synonyms WHERE synonym = $1), $1)`
+
+	err = tx.QueryRowContext(ctx, query, tag).Scan(&tag)
+	if err != nil {
+		return nil, err
+	}
+
+	if tag == synonym {
+		return nil, ErrSynonymChain
+	}
+
+	var hasSynonyms bool
+
+	query = `SELECT EXISTS(SELECT 1 FROM tag_synonyms WHERE tag = $1)`
+
+	err = tx.QueryRowContext(ctx, query, synonym).Scan(&hasSynonyms)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasSynonyms {
+		return nil, ErrSynonymChain
+	}
+
+	query = `
+        INSERT INTO tag_synonyms (synonym, tag)
+        VALUES ($1, $2)
+        ON CONFLICT (synonym) DO UPDATE SET tag = EXCLUDED.tag`
+
+	_, err = tx.ExecContext(ctx, query, synonym, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Synonym{Synonym: synonym, Tag: tag}, tx.Commit()
+}
+
+// DeleteSynonym() removes a synonym. It returns ErrRecordNotFound if there was no such
+// synonym.
+func (m TagModel) DeleteSynonym(synonym string) error {
+	query := `
+        DELETE FROM tag_synonyms
+        WHERE synonym = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, synonym)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetDeleted() returns a snip which has been moved to the trash. Snips which aren't in
+// the trash are reported as ErrRecordNotFound.
+func (m SnipModel) GetDeleted(id int64) (*Snip, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, title, content, tags, COALESCE(owner_id, 0), version, variables, COALESCE(slug, ''), deleted_at
+        FROM snips
+        WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	var snip Snip
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&snip.ID,
+		&snip.CreatedAt,
+		&snip.Title,
+		&snip.Content,
+		pq.Array(&snip.Tags),
+		&snip.OwnerID,
+		&snip.Version,
+		&snip.Variables,
+		&snip.Slug,
+		&snip.DeletedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &snip, nil
+}
+
+// GetAllDeleted() returns the snips in the trash, optionally restricted to a single
+// owner. An ownerID of 0 matches snips regardless of who owns them.
+func (m SnipModel) GetAllDeleted(ownerID int64, filters Filters) ([]*Snip, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, title, content, tags, COALESCE(owner_id, 0), version, variables, COALESCE(slug, ''), deleted_at
+        FROM snips
+        WHERE deleted_at IS NOT NULL
+        AND (owner_id = $1 OR $1 = 0)
+        ORDER BY %s %s, id ASC
+        LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ownerID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	snips := []*Snip{}
+
+	for rows.Next() {
+		var snip Snip
+
+		err := rows.Scan(
+			&totalRecords,
+			&snip.ID,
+			&snip.CreatedAt,
+			&snip.Title,
+			&snip.Content,
+			pq.Array(&snip.Tags),
+			&snip.OwnerID,
+			&snip.Version,
+			&snip.Variables,
+			&snip.Slug,
+			&snip.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		snips = append(snips, &snip)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return snips, metadata, nil
+}
+
+// Restore() takes a snip back out of the trash. It returns ErrRecordNotFound if the
+// snip isn't in the trash.
+func (m SnipModel) Restore(snip *Snip) error {
+	query := `
+        UPDATE snips
+        SET deleted_at = NULL
+        WHERE id = $1 AND deleted_at IS NOT NULL
+        RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, snip.ID).Scan(&snip.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	snip.DeletedAt = nil
+
+	return nil
+}
+
+// Purge() permanently deletes every snip which was moved to the trash before the given
+// time, along with its revision history. It returns the number of snips removed.
+func (m SnipModel) Purge(before time.Time) (int64, error) {
+	query := `
+        DELETE FROM snips
+        WHERE deleted_at < $1`
+
+	// Purging can touch a lot of rows, so allow more time than the usual 3 seconds.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,189 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+
+	"github.com/pwilliams-ck/sniplate/internal/validator"
+)
+
+// The types a snip variable can have.
+const (
+	VariableString  = "string"
+	VariableInteger = "integer"
+	VariableNumber  = "number"
+	VariableBoolean = "boolean"
+)
+
+// Variable names must be valid template field names, so that {{.name}} works.
+var VariableNameRX = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// A Variable is a value which is substituted into a snip when it is rendered.
+type Variable struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     any    `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Variables is the list of variables a snip declares. It is stored as a jsonb column.
+type Variables []Variable
+
+// Value implements driver.Valuer, encoding the variables as JSON.
+func (vs Variables) Value() (driver.Value, error) {
+	if vs == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal(vs)
+}
+
+// Scan implements sql.Scanner, decoding the variables from JSON.
+func (vs *Variables) Scan(src any) error {
+	var data []byte
+
+	switch src := src.(type) {
+	case nil:
+		*vs = nil
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into Variables", src)
+	}
+
+	err := json.Unmarshal(data, vs)
+	if err != nil {
+		return err
+	}
+
+	// Keep snips without variables as nil, so they're left out of JSON responses.
+	if len(*vs) == 0 {
+		*vs = nil
+	}
+
+	return nil
+}
+
+// ValidateVariables checks the variable declarations of a snip.
+func ValidateVariables(v *validator.Validator, variables Variables) {
+	v.Check(len(variables) <= 50, "variables", "must not contain more than 50 variables")
+
+	names := make([]string, 0, len(variables))
+
+	for i, variable := range variables {
+		key := fmt.Sprintf("variables[%d]", i)
+
+		v.Check(variable.Name != "", key+".name", "must be provided")
+		v.Check(len(variable.Name) <= 100, key+".name", "must not be more than 100 bytes long")
+		v.Check(variable.Name == "" || validator.Matches(variable.Name, VariableNameRX), key+".name", "must start with a letter or underscore and contain only letters, digits and underscores")
+		v.Check(!validator.PermittedValue(variable.Name, names...), key+".name", "must be unique")
+		names = append(names, variable.Name)
+
+		v.Check(validator.PermittedValue(variable.Type, VariableString, VariableInteger, VariableNumber, VariableBoolean), key+".type", `must be one of "string", "integer", "number" or "boolean"`)
+		v.Check(len(variable.Description) <= 1000, key+".description", "must not be more than 1000 bytes long")
+
+		if variable.Default != nil {
+			_, err := variable.Convert(variable.Default)
+			v.Check(err == nil, key+".default", fmt.Sprintf("must be a valid %s", variable.Type))
+		}
+	}
+}
+
+// Convert checks that a value decoded from JSON has the type of the variable, and
+// returns it as the Go type templates see: a string, int64, float64 or bool.
+func (variable Variable) Convert(value any) (any, error) {
+	switch variable.Type {
+	case VariableString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case VariableInteger:
+		if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) <= 1<<53 {
+			return int64(f), nil
+		}
+	case VariableNumber:
+		if f, ok := value.(float64); ok {
+			return f, nil
+		}
+	case VariableBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	}
+
+	return nil, errors.New("must be a " + variable.Type)
+}
+
+// zero returns the zero value of the variable's type.
+func (variable Variable) zero() any {
+	switch variable.Type {
+	case VariableInteger:
+		return int64(0)
+	case VariableNumber:
+		return float64(0)
+	case VariableBoolean:
+		return false
+	default:
+		return ""
+	}
+}
+
+// ResolveValues checks the values supplied for a render against the variables and
+// returns the values to render with. Missing values fall back to the variable's
+// default, or to the zero value of its type if it isn't required. Problems are added
+// to the validator under "values.<name>".
+func ResolveValues(v *validator.Validator, variables Variables, values map[string]any) map[string]any {
+	resolved := make(map[string]any, len(variables))
+
+	for _, variable := range variables {
+		key := "values." + variable.Name
+
+		value, ok := values[variable.Name]
+		if !ok || value == nil {
+			switch {
+			case variable.Default != nil:
+				value = variable.Default
+			case variable.Required:
+				v.AddError(key, "must be provided")
+				continue
+			default:
+				resolved[variable.Name] = variable.zero()
+				continue
+			}
+		}
+
+		converted, err := variable.Convert(value)
+		if err != nil {
+			v.AddError(key, err.Error())
+			continue
+		}
+
+		resolved[variable.Name] = converted
+	}
+
+	for name := range values {
+		if _, ok := resolved[name]; !ok && !variables.has(name) {
+			v.AddError("values."+name, "is not a variable of this snip")
+		}
+	}
+
+	return resolved
+}
+
+func (vs Variables) has(name string) bool {
+	for _, variable := range vs {
+		if variable.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,476 @@
+// Package diff computes line-based differences between two texts, and formats them as
+// unified diffs or structured hunks.
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Op describes what happened to a single line between the old and the new text.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// String returns the name of the operation, which is also how it is encoded to JSON.
+func (o Op) String() string {
+	switch o {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	default:
+		return "equal"
+	}
+}
+
+// MarshalText encodes the Op using its name rather than its integer value.
+func (o Op) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText decodes an Op from its name.
+func (o *Op) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "equal":
+		*o = Equal
+	case "delete":
+		*o = Delete
+	case "insert":
+		*o = Insert
+	default:
+		return errors.New("invalid diff op")
+	}
+	return nil
+}
+
+// An Edit is a single line of a diff. Text includes the trailing newline, if the line
+// had one in the original text.
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// A Hunk is a group of nearby edits along with the unchanged lines that surround them.
+// Line numbers are 1-based.
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Edits    []Edit `json:"lines"`
+}
+
+// maxEditDistance bounds the work done by the Myers algorithm. The memory needed to
+// backtrack grows with the square of the number of differing lines, so past this
+// point the remaining lines are reported as a wholesale replacement instead.
+const maxEditDistance = 2000
+
+// SplitLines splits s into lines, keeping the trailing newline on each line. A final
+// line without a newline is kept as is.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// Lines returns the line edits which turn a into b.
+func Lines(a, b string) []Edit {
+	return Compare(SplitLines(a), SplitLines(b))
+}
+
+// Compare returns the edits which turn the lines in a into the lines in b.
+func Compare(a, b []string) []Edit {
+	// Lines shared at the start and end of both texts are by far the most common case
+	// when comparing two versions of a snip, so strip them before running Myers.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]Edit, 0, len(a)+len(b))
+
+	for _, line := range a[:prefix] {
+		edits = append(edits, Edit{Equal, line})
+	}
+
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Equal, line})
+	}
+
+	return edits
+}
+
+// myers implements the greedy algorithm from Eugene Myers' "An O(ND) Difference
+// Algorithm and Its Variations", recording the furthest reaching path for every edit
+// distance d so that the shortest edit script can be recovered by backtracking.
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+
+	// trace[d] holds the furthest x reached on each diagonal k in -d..d, at index k+d.
+	var trace [][]int32
+
+	v := []int32{0, 0}
+	found := false
+
+	for d := 0; d <= n+m && d <= maxEditDistance; d++ {
+		next := make([]int32, 2*d+1)
+
+		for k := -d; k <= d; k += 2 {
+			// Decide whether we reach diagonal k by moving down (an insertion) from
+			// diagonal k+1, or right (a deletion) from diagonal k-1.
+			var x int
+			if k == -d || (k != d && prev(v, d, k-1) < prev(v, d, k+1)) {
+				x = int(prev(v, d, k+1))
+			} else {
+				x = int(prev(v, d, k-1)) + 1
+			}
+			y := x - k
+
+			// Follow the diagonal for as long as the lines match.
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			next[k+d] = int32(x)
+
+			if x >= n && y >= m {
+				found = true
+			}
+		}
+
+		trace = append(trace, next)
+		v = next
+
+		if found {
+			break
+		}
+	}
+
+	if !found {
+		return replaceAll(a, b)
+	}
+
+	// Walk back from the end of both texts to the start, recovering one edit for each
+	// value of d and any matching lines (the "snake") that followed it.
+	var reversed []Edit
+	x, y := n, m
+
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+
+		// Repeat the decision made on the way forward to find the diagonal we came from,
+		// and the point (midX, midY) where the edit ended and the snake began.
+		var prevK int
+		if k == -d || (k != d && at(trace[d-1], d-1, k-1) < at(trace[d-1], d-1, k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := int(at(trace[d-1], d-1, prevK))
+		prevY := prevX - prevK
+
+		midX := prevX
+		if prevK == k-1 {
+			midX++
+		}
+
+		for x > midX {
+			reversed = append(reversed, Edit{Equal, a[x-1]})
+			x--
+			y--
+		}
+
+		if prevK == k+1 {
+			reversed = append(reversed, Edit{Insert, b[prevY]})
+		} else {
+			reversed = append(reversed, Edit{Delete, a[prevX]})
+		}
+
+		x, y = prevX, prevY
+	}
+
+	// Whatever is left is the snake leading out of the origin.
+	for x > 0 {
+		reversed = append(reversed, Edit{Equal, a[x-1]})
+		x--
+	}
+
+	edits := make([]Edit, len(reversed))
+	for i, edit := range reversed {
+		edits[len(reversed)-1-i] = edit
+	}
+
+	return edits
+}
+
+// prev reads the furthest x on diagonal k from the row computed for d-1.
+func prev(v []int32, d, k int) int32 {
+	if d == 0 {
+		return 0
+	}
+	return at(v, d-1, k)
+}
+
+// at reads the furthest x on diagonal k from the row computed for d.
+func at(v []int32, d, k int) int32 {
+	return v[k+d]
+}
+
+// replaceAll returns edits which delete every line in a and insert every line in b.
+func replaceAll(a, b []string) []Edit {
+	edits := make([]Edit, 0, len(a)+len(b))
+	for _, line := range a {
+		edits = append(edits, Edit{Delete, line})
+	}
+	for _, line := range b {
+		edits = append(edits, Edit{Insert, line})
+	}
+	return edits
+}
+
+// Hunks groups edits into hunks, keeping up to context unchanged lines around each
+// change. Changes which are close enough for their context to overlap share a hunk.
+func Hunks(edits []Edit, context int) []Hunk {
+	if context < 0 {
+		context = 0
+	}
+
+	var hunks []Hunk
+
+	// Track the 0-based line position in both texts for every edit.
+	oldPos := make([]int, len(edits)+1)
+	newPos := make([]int, len(edits)+1)
+	for i, edit := range edits {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if edit.Op != Insert {
+			oldPos[i+1]++
+		}
+		if edit.Op != Delete {
+			newPos[i+1]++
+		}
+	}
+
+	i := 0
+	for i < len(edits) {
+		// Skip ahead to the next change.
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+
+		start := max(i-context, 0)
+
+		// Extend the hunk until we find a run of unchanged lines long enough to close
+		// it, or we run out of edits.
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != Equal {
+				end++
+				continue
+			}
+
+			run := end
+			for run < len(edits) && edits[run].Op == Equal {
+				run++
+			}
+
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+
+			end = run
+		}
+
+		hunk := Hunk{
+			OldStart: oldPos[start] + 1,
+			OldLines: oldPos[end] - oldPos[start],
+			NewStart: newPos[start] + 1,
+			NewLines: newPos[end] - newPos[start],
+			Edits:    edits[start:end],
+		}
+
+		// By convention an empty range refers to the line before it.
+		if hunk.OldLines == 0 {
+			hunk.OldStart--
+		}
+		if hunk.NewLines == 0 {
+			hunk.NewStart--
+		}
+
+		hunks = append(hunks, hunk)
+		i = end
+	}
+
+	return hunks
+}
+
+// Unified formats the hunks as a unified diff, using the given names in the "---" and
+// "+++" header lines. It returns the empty string if there are no hunks.
+func Unified(oldName, newName string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	for _, hunk := range hunks {
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(hunk.OldStart, hunk.OldLines), hunkRange(hunk.NewStart, hunk.NewLines))
+
+		for _, edit := range hunk.Edits {
+			switch edit.Op {
+			case Delete:
+				sb.WriteByte('-')
+			case Insert:
+				sb.WriteByte('+')
+			default:
+				sb.WriteByte(' ')
+			}
+
+			sb.WriteString(edit.Text)
+
+			if !strings.HasSuffix(edit.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// A Row is one line of a side-by-side diff. Kind is "equal", "delete", "insert" or
+// "change", where a change pairs a deleted line with the line inserted in its place.
+// Line numbers are 0 on the side where the row has no line.
+type Row struct {
+	Kind    string `json:"kind"`
+	OldLine int    `json:"old_line,omitempty"`
+	OldText string `json:"old_text"`
+	NewLine int    `json:"new_line,omitempty"`
+	NewText string `json:"new_text"`
+}
+
+// A SplitHunk is a Hunk laid out as side-by-side rows.
+type SplitHunk struct {
+	OldStart int   `json:"old_start"`
+	OldLines int   `json:"old_lines"`
+	NewStart int   `json:"new_start"`
+	NewLines int   `json:"new_lines"`
+	Rows     []Row `json:"rows"`
+}
+
+// SideBySide lays out each hunk as rows suitable for a two column view. Runs of deleted
+// lines followed by inserted lines are paired up row by row, so a modified line appears
+// next to its replacement. Trailing newlines are stripped from the text.
+func SideBySide(hunks []Hunk) []SplitHunk {
+	split := make([]SplitHunk, 0, len(hunks))
+
+	for _, hunk := range hunks {
+		oldLine, newLine := hunk.OldStart, hunk.NewStart
+		if hunk.OldLines == 0 {
+			oldLine++
+		}
+		if hunk.NewLines == 0 {
+			newLine++
+		}
+
+		sh := SplitHunk{
+			OldStart: hunk.OldStart,
+			OldLines: hunk.OldLines,
+			NewStart: hunk.NewStart,
+			NewLines: hunk.NewLines,
+		}
+
+		edits := hunk.Edits
+		for len(edits) > 0 {
+			if edits[0].Op == Equal {
+				sh.Rows = append(sh.Rows, Row{
+					Kind:    "equal",
+					OldLine: oldLine,
+					OldText: trimNewline(edits[0].Text),
+					NewLine: newLine,
+					NewText: trimNewline(edits[0].Text),
+				})
+				oldLine++
+				newLine++
+				edits = edits[1:]
+				continue
+			}
+
+			// Collect the run of deletions and the run of insertions that follows it.
+			var deleted, inserted []string
+			for len(edits) > 0 && edits[0].Op == Delete {
+				deleted = append(deleted, edits[0].Text)
+				edits = edits[1:]
+			}
+			for len(edits) > 0 && edits[0].Op == Insert {
+				inserted = append(inserted, edits[0].Text)
+				edits = edits[1:]
+			}
+
+			for i := 0; i < max(len(deleted), len(inserted)); i++ {
+				var row Row
+
+				switch {
+				case i < len(deleted) && i < len(inserted):
+					row.Kind = "change"
+				case i < len(deleted):
+					row.Kind = "delete"
+				default:
+					row.Kind = "insert"
+				}
+
+				if i < len(deleted) {
+					row.OldLine = oldLine
+					row.OldText = trimNewline(deleted[i])
+					oldLine++
+				}
+				if i < len(inserted) {
+					row.NewLine = newLine
+					row.NewText = trimNewline(inserted[i])
+					newLine++
+				}
+
+				sh.Rows = append(sh.Rows, row)
+			}
+		}
+
+		split = append(split, sh)
+	}
+
+	return split
+}
+
+func trimNewline(s string) string {
+	return strings.TrimSuffix(s, "\n")
+}
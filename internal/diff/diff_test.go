@@ -0,0 +1,130 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// apply rebuilds the old and new texts from edits.
+func apply(edits []Edit) (string, string) {
+	var a, b strings.Builder
+
+	for _, edit := range edits {
+		if edit.Op != Insert {
+			a.WriteString(edit.Text)
+		}
+		if edit.Op != Delete {
+			b.WriteString(edit.Text)
+		}
+	}
+
+	return a.String(), b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		edits []Edit
+	}{
+		{"both empty", "", "", []Edit{}},
+		{"from empty", "", "a\nb\n", []Edit{{Insert, "a\n"}, {Insert, "b\n"}}},
+		{"to empty", "a\nb\n", "", []Edit{{Delete, "a\n"}, {Delete, "b\n"}}},
+		{"identical", "a\nb\n", "a\nb\n", []Edit{{Equal, "a\n"}, {Equal, "b\n"}}},
+		{"all changed", "a\nb\n", "c\nd\n", []Edit{{Delete, "a\n"}, {Delete, "b\n"}, {Insert, "c\n"}, {Insert, "d\n"}}},
+		{"middle changed", "a\nb\nc\n", "a\nx\nc\n", []Edit{{Equal, "a\n"}, {Delete, "b\n"}, {Insert, "x\n"}, {Equal, "c\n"}}},
+		{"line inserted", "a\nc\n", "a\nb\nc\n", []Edit{{Equal, "a\n"}, {Insert, "b\n"}, {Equal, "c\n"}}},
+		{"newline added", "a", "a\n", []Edit{{Delete, "a"}, {Insert, "a\n"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := Lines(tt.a, tt.b)
+			if !reflect.DeepEqual(edits, tt.edits) {
+				t.Errorf("got %v; want %v", edits, tt.edits)
+			}
+		})
+	}
+}
+
+func TestLinesRebuildsBothTexts(t *testing.T) {
+	var many, other strings.Builder
+	for i := range 3000 {
+		fmt.Fprintf(&many, "line %d\n", i)
+		fmt.Fprintf(&other, "other %d\n", i)
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"interleaved", "a\nb\nc\nd\ne\n", "b\nx\nd\ny\ne\nz\n"},
+		{"repeated lines", "a\na\nb\na\n", "a\nb\na\na\n"},
+		{"past the edit distance limit", many.String(), other.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := apply(Lines(tt.a, tt.b))
+			if a != tt.a || b != tt.b {
+				t.Errorf("edits don't rebuild the inputs")
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", ""},
+		{"from empty", "", "a\n", "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n"},
+		{"middle changed", "a\nb\nc\n", "a\nx\nc\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{
+			"no newline at end",
+			"a", "b",
+			"--- old\n+++ new\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n", "x\n2\n3\n4\n5\n6\ny\n",
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+y\n",
+		},
+		{
+			"overlapping context",
+			"1\n2\n3\n4\n", "x\n2\n3\ny\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n-4\n+y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("old", "new", Hunks(Lines(tt.a, tt.b), 1))
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	hunks := Hunks(Lines("a\nb\nc\n", "a\nx\ny\nc\n"), 1)
+
+	want := []SplitHunk{{
+		OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 4,
+		Rows: []Row{
+			{Kind: "equal", OldLine: 1, OldText: "a", NewLine: 1, NewText: "a"},
+			{Kind: "change", OldLine: 2, OldText: "b", NewLine: 2, NewText: "x"},
+			{Kind: "insert", NewLine: 3, NewText: "y"},
+			{Kind: "equal", OldLine: 3, OldText: "c", NewLine: 4, NewText: "c"},
+		},
+	}}
+
+	if got := SideBySide(hunks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+}
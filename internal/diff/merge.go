@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+)
+
+// MergeLabels names the three inputs to a merge. The labels are written next to the
+// conflict markers so that readers can tell which side each block came from.
+type MergeLabels struct {
+	Ours   string
+	Base   string
+	Theirs string
+}
+
+// Merge performs a line-level three-way merge, combining the changes made in ours and
+// theirs since they both diverged from base. Regions changed on only one side (or
+// changed identically on both) merge cleanly. Regions changed differently on both sides
+// are written out between conflict markers, in the diff3 style:
+//
+//	<<<<<<< ours
+//	...
+//	||||||| base
+//	...
+//	=======
+//	...
+//	>>>>>>> theirs
+//
+// Merge returns the merged text and the number of conflicting regions. If conflicts is
+// zero the merged text contains no markers.
+func Merge(base, ours, theirs string, labels MergeLabels) (merged string, conflicts int) {
+	baseLines := SplitLines(base)
+	ourLines := SplitLines(ours)
+	theirLines := SplitLines(theirs)
+
+	// For every base line, find the line it was matched with on each side, or -1 if
+	// it was changed or deleted on that side.
+	ourMatches := matches(len(baseLines), Compare(baseLines, ourLines))
+	theirMatches := matches(len(baseLines), Compare(baseLines, theirLines))
+
+	var sb strings.Builder
+	o, a, b := 0, 0, 0
+
+	for o < len(baseLines) || a < len(ourLines) || b < len(theirLines) {
+		// Lines which are unchanged on both sides are copied straight across.
+		if o < len(baseLines) && ourMatches[o] == a && theirMatches[o] == b {
+			sb.WriteString(baseLines[o])
+			o, a, b = o+1, a+1, b+1
+			continue
+		}
+
+		// Otherwise find the next base line which both sides kept. Everything before it
+		// is a chunk which at least one side changed.
+		nextO, nextA, nextB := len(baseLines), len(ourLines), len(theirLines)
+		for i := o; i < len(baseLines); i++ {
+			if ourMatches[i] >= 0 && theirMatches[i] >= 0 {
+				nextO, nextA, nextB = i, ourMatches[i], theirMatches[i]
+				break
+			}
+		}
+
+		baseChunk := baseLines[o:nextO]
+		ourChunk := ourLines[a:nextA]
+		theirChunk := theirLines[b:nextB]
+
+		switch {
+		case slices.Equal(ourChunk, baseChunk):
+			writeLines(&sb, theirChunk)
+		case slices.Equal(theirChunk, baseChunk), slices.Equal(ourChunk, theirChunk):
+			writeLines(&sb, ourChunk)
+		default:
+			conflicts++
+			writeMarker(&sb, "<<<<<<<", labels.Ours)
+			writeBlock(&sb, ourChunk)
+			writeMarker(&sb, "|||||||", labels.Base)
+			writeBlock(&sb, baseChunk)
+			writeMarker(&sb, "=======", "")
+			writeBlock(&sb, theirChunk)
+			writeMarker(&sb, ">>>>>>>", labels.Theirs)
+		}
+
+		o, a, b = nextO, nextA, nextB
+	}
+
+	return sb.String(), conflicts
+}
+
+// matches maps each line of the old text to the index of the line it is equal to in
+// the new text, or -1 if the line was deleted.
+func matches(n int, edits []Edit) []int {
+	m := make([]int, n)
+	oldPos, newPos := 0, 0
+
+	for _, edit := range edits {
+		switch edit.Op {
+		case Equal:
+			m[oldPos] = newPos
+			oldPos++
+			newPos++
+		case Delete:
+			m[oldPos] = -1
+			oldPos++
+		case Insert:
+			newPos++
+		}
+	}
+
+	return m
+}
+
+func writeLines(sb *strings.Builder, lines []string) {
+	for _, line := range lines {
+		sb.WriteString(line)
+	}
+}
+
+// writeBlock writes lines inside a conflict, making sure the block ends with a newline
+// so the following marker starts on a line of its own.
+func writeBlock(sb *strings.Builder, lines []string) {
+	writeLines(sb, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		sb.WriteByte('\n')
+	}
+}
+
+func writeMarker(sb *strings.Builder, marker, label string) {
+	sb.WriteString(marker)
+	if label != "" {
+		sb.WriteByte(' ')
+		sb.WriteString(label)
+	}
+	sb.WriteByte('\n')
+}
@@ -0,0 +1,53 @@
+package diff
+
+import "testing"
+
+func TestMerge(t *testing.T) {
+	labels := MergeLabels{Ours: "ours", Base: "base", Theirs: "theirs"}
+
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		merged             string
+		conflicts          int
+	}{
+		{"all empty", "", "", "", "", 0},
+		{"nothing changed", "a\nb\n", "a\nb\n", "a\nb\n", "a\nb\n", 0},
+		{"only ours changed", "a\nb\nc\n", "a\nx\nc\n", "a\nb\nc\n", "a\nx\nc\n", 0},
+		{"only theirs changed", "a\nb\nc\n", "a\nb\nc\n", "a\nb\ny\n", "a\nb\ny\n", 0},
+		{"separate changes", "a\nb\nc\nd\ne\n", "x\nb\nc\nd\ne\n", "a\nb\nc\nd\ny\n", "x\nb\nc\nd\ny\n", 0},
+		{"same change on both sides", "a\nb\nc\n", "a\nx\nc\n", "a\nx\nc\n", "a\nx\nc\n", 0},
+		{"insert and delete", "a\nb\nc\n", "a\nb\nb2\nc\n", "b\nc\n", "b\nb2\nc\n", 0},
+		{"both append", "a\n", "a\nx\n", "a\ny\n", "a\n<<<<<<< ours\nx\n||||||| base\n=======\ny\n>>>>>>> theirs\n", 1},
+		{
+			"overlapping changes",
+			"a\nb\nc\n", "a\nx\nc\n", "a\ny\nc\n",
+			"a\n<<<<<<< ours\nx\n||||||| base\nb\n=======\ny\n>>>>>>> theirs\nc\n",
+			1,
+		},
+		{
+			"two conflicts",
+			"a\nb\nc\nd\ne\n", "x\nb\nc\nd\nx\n", "y\nb\nc\nd\ny\n",
+			"<<<<<<< ours\nx\n||||||| base\na\n=======\ny\n>>>>>>> theirs\nb\nc\nd\n<<<<<<< ours\nx\n||||||| base\ne\n=======\ny\n>>>>>>> theirs\n",
+			2,
+		},
+		{
+			"conflict without trailing newline",
+			"a", "b", "c",
+			"<<<<<<< ours\nb\n||||||| base\na\n=======\nc\n>>>>>>> theirs\n",
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts := Merge(tt.base, tt.ours, tt.theirs, labels)
+			if merged != tt.merged {
+				t.Errorf("got merged text:\n%s\nwant:\n%s", merged, tt.merged)
+			}
+			if conflicts != tt.conflicts {
+				t.Errorf("got %d conflicts; want %d", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
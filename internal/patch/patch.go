@@ -0,0 +1,390 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+// documents to JSON values.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Media types for the two patch formats.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrTestFailed is returned when a JSON Patch "test" operation doesn't match the
+// document.
+var ErrTestFailed = errors.New("test operation failed")
+
+// MergePatch applies a JSON Merge Patch to doc and returns the patched document.
+// Members of the patch replace the matching members of the document, members set to
+// null are removed, and objects are merged recursively. Any other patch value,
+// including an array, replaces the target outright.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergeValue(targetObj[key], value)
+	}
+
+	return targetObj
+}
+
+// An Operation is a single step of a JSON Patch document.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// DecodeOperations parses a JSON Patch document, which must be an array of
+// operations. Members of an operation other than those it defines are ignored, as
+// RFC 6902 requires.
+func DecodeOperations(data []byte) ([]Operation, error) {
+	var ops []Operation
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	err := dec.Decode(&ops)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+
+	// Decode again to make sure nothing follows the array. More() isn't enough here, as
+	// it reports false for a stray closing bracket or brace.
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return nil, errors.New("invalid JSON patch: body must only contain a single JSON value")
+	}
+
+	return ops, nil
+}
+
+// Apply applies a JSON Patch to doc and returns the patched document. The add,
+// remove, replace and test operations are supported. Operations are applied in order,
+// and if any of them fails the whole patch is rejected.
+func Apply(doc []byte, ops []Operation) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	for i, op := range ops {
+		target, err = applyOperation(target, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func applyOperation(doc any, op Operation) (any, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New(`missing "value" member`)
+		}
+		value, err = decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value: %w", err)
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op.Op)
+	}
+
+	// Operations on the root replace (or test) the whole document.
+	if len(tokens) == 0 {
+		switch op.Op {
+		case "add", "replace":
+			return value, nil
+		case "test":
+			if !equal(doc, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		default:
+			return nil, errors.New("cannot remove the whole document")
+		}
+	}
+
+	parent, err := resolve(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	key := tokens[len(tokens)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		_, exists := container[key]
+
+		switch op.Op {
+		case "add":
+			container[key] = value
+		case "replace":
+			if !exists {
+				return nil, fmt.Errorf("member %q does not exist", key)
+			}
+			container[key] = value
+		case "remove":
+			if !exists {
+				return nil, fmt.Errorf("member %q does not exist", key)
+			}
+			delete(container, key)
+		case "test":
+			if !exists || !equal(container[key], value) {
+				return nil, ErrTestFailed
+			}
+		}
+
+		return doc, nil
+
+	case []any:
+		// Arrays are held by value in their parent, so after changing the length we
+		// have to store the new slice back in place.
+		var updated []any
+
+		switch op.Op {
+		case "add":
+			index := len(container)
+			if key != "-" {
+				index, err = arrayIndex(key, len(container))
+				if err != nil {
+					return nil, err
+				}
+			}
+			updated = append(updated, container[:index]...)
+			updated = append(updated, value)
+			updated = append(updated, container[index:]...)
+		case "replace", "remove", "test":
+			index, err := arrayIndex(key, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			switch op.Op {
+			case "replace":
+				container[index] = value
+				return doc, nil
+			case "test":
+				if !equal(container[index], value) {
+					return nil, ErrTestFailed
+				}
+				return doc, nil
+			}
+
+			updated = append(updated, container[:index]...)
+			updated = append(updated, container[index+1:]...)
+		}
+
+		return replaceAt(doc, tokens[:len(tokens)-1], updated)
+
+	default:
+		return nil, fmt.Errorf("cannot index into %s", kind(parent))
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// resolve walks the reference tokens from the root of the document and returns the
+// value they point to.
+func resolve(doc any, tokens []string) (any, error) {
+	current := doc
+
+	for _, token := range tokens {
+		switch container := current.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			current = value
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			current = container[index]
+		default:
+			return nil, fmt.Errorf("cannot index into %s", kind(current))
+		}
+	}
+
+	return current, nil
+}
+
+// replaceAt stores value at the location the reference tokens point to, and returns
+// the (possibly new) root of the document.
+func replaceAt(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	parent, err := resolve(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	key := tokens[len(tokens)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		container[key] = value
+	case []any:
+		index, err := arrayIndex(key, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = value
+	}
+
+	return doc, nil
+}
+
+// arrayIndex parses an array index token, which must be between 0 and max inclusive.
+// Leading zeros are not allowed.
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	if index > max {
+		return 0, fmt.Errorf("array index %d out of bounds", index)
+	}
+
+	return index, nil
+}
+
+// decode parses a single JSON value, keeping numbers as json.Number so that integers
+// such as ids round trip exactly.
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return nil, errors.New("body must only contain a single JSON value")
+	}
+
+	return v, nil
+}
+
+// equal compares two decoded JSON values, treating numbers as equal when they have the
+// same numeric value, as required by the "test" operation.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if a == b {
+			return true
+		}
+		af, aerr := a.Float64()
+		bf, berr := b.Float64()
+		return aerr == nil && berr == nil && af == bf
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func kind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	default:
+		return "a value"
+	}
+}
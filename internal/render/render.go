@@ -0,0 +1,549 @@
+// Package render executes snip content as a text/template in a sandbox. Templates may
+// only use a safe subset of the template language, their output is capped, and their
+// execution is bounded in time.
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+var (
+	// ErrOutputTooLarge is returned when a template produces more output than allowed.
+	ErrOutputTooLarge = errors.New("rendered output is too large")
+
+	// ErrTimeout is returned when a template takes too long to execute.
+	ErrTimeout = errors.New("rendering took too long")
+)
+
+// IncludeFunc is the name of the function templates use to include other snips, as in
+// {{include "license"}}. Its argument must be a string literal, so that every include
+// can be found and resolved before the template is executed. Templates returned by
+// Parse fail if they call it, until the caller provides it with Funcs.
+const IncludeFunc = "include"
+
+// Limits bound the resources a single render may use.
+type Limits struct {
+	MaxOutput int           // Maximum size of the rendered output in bytes
+	Timeout   time.Duration // Maximum time to spend executing the template
+}
+
+// Builtin template functions which can't be used to run arbitrary code or produce
+// unbounded output. Notably "call" is missing, and printf is replaced with a version
+// which refuses huge widths and precisions.
+var safeFuncs = []string{
+	"and", "or", "not", "len", "index", "slice",
+	"eq", "ne", "lt", "le", "gt", "ge",
+	"html", "js", "urlquery", "print", "println", "printf",
+}
+
+// Parse parses text as a sandboxed template. Actions may use variables, conditionals
+// (if and with), include and the safe builtin functions, along with any extra
+// functions given, but not range loops or nested template definitions, which could be
+// used to run for an unbounded time. Referencing a missing variable is an error when
+// the template is executed.
+func Parse(name, text string, funcs template.FuncMap) (*template.Template, error) {
+	allowed := make(map[string]bool, len(safeFuncs)+len(funcs))
+	for _, fn := range safeFuncs {
+		allowed[fn] = true
+	}
+	for fn := range funcs {
+		allowed[fn] = true
+	}
+
+	allowed[IncludeFunc] = true
+
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"printf": printf, IncludeFunc: noInclude}).
+		Funcs(funcs).
+		Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tmpl.Templates()) > 1 {
+		return nil, errors.New("defining templates is not allowed")
+	}
+
+	if tmpl.Tree != nil {
+		err = checkNode(tmpl.Tree.Root, allowed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tmpl, nil
+}
+
+// checkNode walks the parse tree, rejecting anything outside the sandbox.
+func checkNode(node parse.Node, allowed map[string]bool) error {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkNode(child, allowed); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkPipe(n.Pipe, allowed)
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode, allowed)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode, allowed)
+	case *parse.RangeNode:
+		return errors.New("range is not allowed")
+	case *parse.TemplateNode:
+		return errors.New("template and block are not allowed")
+	case *parse.TextNode, *parse.CommentNode:
+	default:
+		return fmt.Errorf("%s is not allowed", node)
+	}
+
+	return nil
+}
+
+func checkBranch(n *parse.BranchNode, allowed map[string]bool) error {
+	if err := checkPipe(n.Pipe, allowed); err != nil {
+		return err
+	}
+	if err := checkNode(n.List, allowed); err != nil {
+		return err
+	}
+	return checkNode(n.ElseList, allowed)
+}
+
+func checkPipe(pipe *parse.PipeNode, allowed map[string]bool) error {
+	if pipe == nil {
+		return nil
+	}
+
+	// Variables would let a template reuse a value without writing it out, doubling it
+	// up line after line in memory.
+	if len(pipe.Decl) > 0 {
+		return errors.New("variable declarations are not allowed")
+	}
+
+	for _, cmd := range pipe.Cmds {
+		if _, ok := includeArg(cmd); ok {
+			continue
+		}
+
+		for _, arg := range cmd.Args {
+			if err := checkArg(arg, allowed); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkArg(arg parse.Node, allowed map[string]bool) error {
+	switch a := arg.(type) {
+	case *parse.IdentifierNode:
+		if a.Ident == IncludeFunc {
+			return errors.New("include must be given a single quoted snip reference")
+		}
+		if !allowed[a.Ident] {
+			return fmt.Errorf("function %q is not allowed", a.Ident)
+		}
+	case *parse.PipeNode:
+		return checkPipe(a, allowed)
+	case *parse.ChainNode:
+		return checkArg(a.Node, allowed)
+	}
+
+	return nil
+}
+
+// includeArg returns the snip reference if cmd is a call to include with a string
+// literal argument.
+func includeArg(cmd *parse.CommandNode) (string, bool) {
+	if len(cmd.Args) != 2 {
+		return "", false
+	}
+
+	fn, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok || fn.Ident != IncludeFunc {
+		return "", false
+	}
+
+	ref, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return "", false
+	}
+
+	return ref.Text, true
+}
+
+// Includes returns the references of the snips a template parsed by Parse includes, in
+// the order they first appear.
+func Includes(tmpl *template.Template) []string {
+	var refs []string
+
+	var walk func(node parse.Node)
+	walkPipe := func(pipe *parse.PipeNode) {
+		if pipe == nil {
+			return
+		}
+		for _, cmd := range pipe.Cmds {
+			if ref, ok := includeArg(cmd); ok && !slices.Contains(refs, ref) {
+				refs = append(refs, ref)
+			}
+			for _, arg := range cmd.Args {
+				if c, ok := arg.(*parse.ChainNode); ok {
+					arg = c.Node
+				}
+				if p, ok := arg.(*parse.PipeNode); ok {
+					walk(p)
+				}
+			}
+		}
+	}
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.PipeNode:
+			walkPipe(n)
+		case *parse.ActionNode:
+			walkPipe(n.Pipe)
+		case *parse.IfNode:
+			walkPipe(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walkPipe(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+
+	if tmpl.Tree != nil {
+		walk(tmpl.Tree.Root)
+	}
+
+	return refs
+}
+
+// noInclude stands in for include until the caller provides the real function.
+func noInclude(ref string) (string, error) {
+	return "", errors.New("includes are not available here")
+}
+
+// A Budget is the output and time allowed for a render, shared by every template
+// executed as part of it, such as the snips included by another. Output counts against
+// it once for each template which writes it, so the output of an included snip counts
+// again when the snip including it writes it out.
+type Budget struct {
+	mu        sync.Mutex
+	remaining int
+	deadline  time.Time
+}
+
+// NewBudget returns a budget with the output and time allowed by the limits, starting
+// now.
+func NewBudget(limits Limits) *Budget {
+	return &Budget{remaining: limits.MaxOutput, deadline: time.Now().Add(limits.Timeout)}
+}
+
+// check returns an error if the deadline has passed, or if n more bytes wouldn't fit.
+func (b *Budget) check(n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.checkLocked(n)
+}
+
+func (b *Budget) checkLocked(n int) error {
+	if time.Now().After(b.deadline) {
+		return ErrTimeout
+	}
+	if n > b.remaining {
+		return ErrOutputTooLarge
+	}
+	return nil
+}
+
+// spend takes n bytes from the budget, if they fit.
+func (b *Budget) spend(n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.checkLocked(n); err != nil {
+		return err
+	}
+	b.remaining -= n
+	return nil
+}
+
+// left returns how many bytes are left in the budget.
+func (b *Budget) left() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.remaining
+}
+
+// Execute runs the template with the given data, within the limits.
+func Execute(tmpl *template.Template, data any, limits Limits) (string, error) {
+	return NewBudget(limits).Execute(tmpl, data)
+}
+
+// Execute runs the template with the given data, within what's left of the budget.
+func (b *Budget) Execute(tmpl *template.Template, data any) (string, error) {
+	out := &limitedBuffer{budget: b}
+
+	// The functions which build strings are bound to this execution's budget, so run a
+	// copy of the template rather than changing the caller's.
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(limitFuncs(b))
+
+	done := make(chan error, 1)
+
+	// Sandboxed templates have no loops, and the functions which build strings stop
+	// once the deadline passes, so they always finish quickly, but run them in a
+	// goroutine anyway so that the caller gets an answer within the time limit.
+	go func() {
+		done <- tmpl.Execute(out, data)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			// The template package wraps errors returned by writes and functions.
+			switch {
+			case errors.Is(err, ErrOutputTooLarge):
+				return "", ErrOutputTooLarge
+			case errors.Is(err, ErrTimeout):
+				return "", ErrTimeout
+			default:
+				return "", err
+			}
+		}
+		return out.String(), nil
+	case <-time.After(time.Until(b.deadline)):
+		return "", ErrTimeout
+	}
+}
+
+// limitedBuffer is a bytes.Buffer which fails writes once its budget runs out, which
+// stops template execution.
+type limitedBuffer struct {
+	bytes.Buffer
+	budget *Budget
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if err := b.budget.spend(len(p)); err != nil {
+		return 0, err
+	}
+	return b.Buffer.Write(p)
+}
+
+// limitFuncs returns the builtin functions which build strings, wrapped so that they
+// fail once the string they would build doesn't fit in what's left of the output, or
+// once the deadline has passed. Otherwise a template could build a huge string in
+// memory without ever writing it, as in {{with print . . .}}{{with print . . .}}...
+func limitFuncs(budget *Budget) template.FuncMap {
+	limit := func(fn func(args ...any) (string, error), extra func(args []any) int) func(args ...any) (string, error) {
+		return func(args ...any) (string, error) {
+			// Check the size of the arguments first, so the string is never built if
+			// it clearly won't fit.
+			if err := budget.check(argsSize(args, budget.left()) + extra(args)); err != nil {
+				return "", err
+			}
+
+			s, err := fn(args...)
+			if err != nil {
+				return "", err
+			}
+
+			// Escaping can make the string longer than its arguments.
+			if err := budget.check(len(s)); err != nil {
+				return "", err
+			}
+
+			return s, nil
+		}
+	}
+
+	none := func(args []any) int { return 0 }
+	wrap := func(fn func(args ...any) string) func(args ...any) (string, error) {
+		return func(args ...any) (string, error) { return fn(args...), nil }
+	}
+
+	// Every verb in a printf format may be padded up to maxFormatWidth.
+	padding := func(args []any) int {
+		if len(args) == 0 {
+			return 0
+		}
+		format, _ := args[0].(string)
+		return strings.Count(format, "%") * maxFormatWidth
+	}
+
+	return template.FuncMap{
+		"print":    limit(wrap(fmt.Sprint), none),
+		"println":  limit(wrap(fmt.Sprintln), none),
+		"html":     limit(wrap(template.HTMLEscaper), none),
+		"js":       limit(wrap(template.JSEscaper), none),
+		"urlquery": limit(wrap(template.URLQueryEscaper), none),
+		"printf": limit(func(args ...any) (string, error) {
+			if len(args) == 0 {
+				return "", errors.New("printf: missing format")
+			}
+			format, ok := args[0].(string)
+			if !ok {
+				return "", errors.New("printf: format must be a string")
+			}
+			return printf(format, args[1:]...)
+		}, padding),
+	}
+}
+
+// argsSize returns the combined length of the arguments once formatted, stopping as
+// soon as it passes max.
+func argsSize(args []any, max int) int {
+	n := 0
+
+	for _, arg := range args {
+		if s, ok := arg.(string); ok {
+			n += len(s)
+		} else {
+			n += len(fmt.Sprint(arg))
+		}
+
+		if n > max {
+			break
+		}
+	}
+
+	return n
+}
+
+// The largest width or precision printf accepts. Without a limit, a format such as
+// "%0999999999d" would allocate gigabytes before the output limit could catch it.
+const maxFormatWidth = 1000
+
+// printf is fmt.Sprintf, but rejects formats with a * width or precision, or one larger
+// than maxFormatWidth.
+func printf(format string, args ...any) (string, error) {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+
+		n := 0
+		for i++; i < len(format); i++ {
+			c := format[i]
+			switch {
+			case c == '*':
+				return "", errors.New("printf: * widths are not allowed")
+			case c >= '0' && c <= '9':
+				n = n*10 + int(c-'0')
+				if n > maxFormatWidth {
+					return "", fmt.Errorf("printf: widths and precisions must not be more than %d", maxFormatWidth)
+				}
+				continue
+			case c == '.' || c == '-' || c == '+' || c == '#' || c == ' ' || c == '[' || c == ']':
+				n = 0
+				continue
+			}
+			break
+		}
+	}
+
+	return fmt.Sprintf(format, args...), nil
+}
+
+// A Segment is a piece of a template: literal text, an action which only outputs a
+// variable, such as {{.name}}, or any other action.
+type Segment struct {
+	Text     string
+	Variable string
+	Action   string // Any other action, such as an if or an include, as written
+}
+
+// Segments splits a template parsed by Parse into literal text and the actions which
+// output a variable, for converting it into other template languages. Actions which
+// only output a string constant, such as the {{"{{"}} escape, become the text of the
+// string. Every other action is returned in Action, exactly as written, as it has no
+// equivalent outside the template language.
+func Segments(tmpl *template.Template) []Segment {
+	if tmpl.Tree == nil {
+		return nil
+	}
+
+	var segments []Segment
+
+	for _, node := range tmpl.Tree.Root.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			segments = append(segments, Segment{Text: string(n.Text)})
+		case *parse.ActionNode:
+			if name, ok := variableField(n.Pipe); ok {
+				segments = append(segments, Segment{Variable: name})
+				continue
+			}
+			if text, ok := stringConstant(n.Pipe); ok {
+				segments = append(segments, Segment{Text: text})
+				continue
+			}
+			segments = append(segments, Segment{Action: n.String()})
+		default:
+			segments = append(segments, Segment{Action: n.String()})
+		}
+	}
+
+	return segments
+}
+
+// stringConstant returns the string if the pipeline is just a string constant, like
+// "{{".
+func stringConstant(pipe *parse.PipeNode) (string, bool) {
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return "", false
+	}
+
+	str, ok := pipe.Cmds[0].Args[0].(*parse.StringNode)
+	if !ok {
+		return "", false
+	}
+
+	return str.Text, true
+}
+
+// variableField returns the variable name if the pipeline is just a field, like .name.
+func variableField(pipe *parse.PipeNode) (string, bool) {
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return "", false
+	}
+
+	field, ok := pipe.Cmds[0].Args[0].(*parse.FieldNode)
+	if !ok || len(field.Ident) != 1 {
+		return "", false
+	}
+
+	return field.Ident[0], true
+}
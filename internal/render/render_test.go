@@ -0,0 +1,144 @@
+package render
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+var testLimits = Limits{MaxOutput: 1 << 10, Timeout: time.Second}
+
+func TestParseAndExecute(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		data   map[string]any
+		output string
+	}{
+		{"text", "hello", nil, "hello"},
+		{"variable", "hello {{.name}}", map[string]any{"name": "world"}, "hello world"},
+		{"if", "{{if .on}}yes{{else}}no{{end}}", map[string]any{"on": false}, "no"},
+		{"with", "{{with .name}}<{{.}}>{{end}}", map[string]any{"name": "x"}, "<x>"},
+		{"comparison", "{{if eq .n 3.0}}three{{end}}", map[string]any{"n": 3.0}, "three"},
+		{"print", `{{print .a "-" .b}}`, map[string]any{"a": "x", "b": "y"}, "x-y"},
+		{"printf", `{{printf "%05d" 42}}`, nil, "00042"},
+		{"escapes", `{{html .s}} {{urlquery .s}}`, map[string]any{"s": "a&b"}, "a&amp;b a%26b"},
+		{"escaped braces", `{{"{{"}}x}}`, nil, "{{x}}"},
+		{"comment", "a{{/* note */}}b", nil, "ab"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse("test", tt.text, nil)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+
+			output, err := Execute(tmpl, tt.data, testLimits)
+			if err != nil {
+				t.Fatalf("unexpected execute error: %v", err)
+			}
+			if output != tt.output {
+				t.Errorf("got %q; want %q", output, tt.output)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		err  string
+	}{
+		{"range", "{{range .items}}x{{end}}", "range is not allowed"},
+		{"define", `{{define "x"}}y{{end}}`, "defining templates is not allowed"},
+		{"template", `{{template "x"}}`, "template and block are not allowed"},
+		{"block", `{{block "x" .}}y{{end}}`, "defining templates is not allowed"},
+		{"call", "{{call .fn}}", `function "call" is not allowed`},
+		{"call in pipeline", "{{.x | call}}", `function "call" is not allowed`},
+		{"declaration", "{{$a := .x}}", "variable declarations are not allowed"},
+		{"assignment in with", "{{with $a := .x}}{{end}}", "variable declarations are not allowed"},
+		{"nested declaration", "{{if .x}}{{$a := print .x .x}}{{end}}", "variable declarations are not allowed"},
+		{"include variable", "{{include .ref}}", "include must be given a single quoted snip reference"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("test", tt.text, nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %q; want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExecuteLimits(t *testing.T) {
+	// Each with multiplies the length of the value by ten, and nothing is ever written
+	// out, so only the limits on the functions themselves can stop it.
+	blowup := strings.Repeat("{{with print . . . . . . . . . .}}", 7) + "{{if not .}}{{end}}" + strings.Repeat("{{end}}", 7)
+
+	tests := []struct {
+		name string
+		text string
+		data any
+		err  error
+	}{
+		{"output", `{{printf "%s%s" .s .s}}`, map[string]any{"s": strings.Repeat("x", 600)}, ErrOutputTooLarge},
+		{"text", strings.Repeat("x", 2000), nil, ErrOutputTooLarge},
+		{"nested print", blowup, "0123456789", ErrOutputTooLarge},
+		{"many print arguments", "{{if print" + strings.Repeat(" .", 200) + "}}{{end}}", strings.Repeat("x", 100), ErrOutputTooLarge},
+		{"escaping", "{{if html .}}{{end}}", strings.Repeat("<", 500), ErrOutputTooLarge},
+		{"printf padding", `{{if printf "%999d%999d" 1 2}}{{end}}`, nil, ErrOutputTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse("test", tt.text, nil)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+
+			_, err = Execute(tmpl, tt.data, testLimits)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v; want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	slow := template.FuncMap{"slow": func() string {
+		time.Sleep(50 * time.Millisecond)
+		return ""
+	}}
+
+	tmpl, err := Parse("test", "{{slow}}{{print .}}", slow)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	_, err = Execute(tmpl, "x", Limits{MaxOutput: 1 << 10, Timeout: 10 * time.Millisecond})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v; want %v", err, ErrTimeout)
+	}
+}
+
+func TestExecuteLeavesTemplateUnchanged(t *testing.T) {
+	tmpl, err := Parse("test", "{{print .}}", nil)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	for _, max := range []int{1, 100} {
+		_, err = Execute(tmpl, "hello", Limits{MaxOutput: max, Timeout: time.Second})
+	}
+	if err != nil {
+		t.Errorf("a later execution with a larger limit failed: %v", err)
+	}
+}
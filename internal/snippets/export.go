@@ -0,0 +1,203 @@
+package snippets
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+)
+
+// body writes pieces in the TextMate snippet syntax shared by VS Code, UltiSnips and
+// yasnippet, where tabstops look like ${1:default}. Special characters in the text are
+// escaped with a backslash.
+func body(pieces []piece, special string) string {
+	var b strings.Builder
+
+	escape := func(s, special string) string {
+		var e strings.Builder
+		for _, r := range s {
+			if r == '\\' || strings.ContainsRune(special, r) {
+				e.WriteByte('\\')
+			}
+			e.WriteRune(r)
+		}
+		return e.String()
+	}
+
+	for _, p := range pieces {
+		switch {
+		case p.tabstop == 0:
+			b.WriteString(escape(p.text, special))
+		case p.mirror || p.value == "":
+			fmt.Fprintf(&b, "$%d", p.tabstop)
+		default:
+			fmt.Fprintf(&b, "${%d:%s}", p.tabstop, escape(p.value, special+"}"))
+		}
+	}
+
+	return b.String()
+}
+
+// uniqueName returns name, or name followed by the snip id if name is already taken.
+func uniqueName(taken map[string]bool, name string, snip *data.Snip) string {
+	if taken[name] {
+		name = fmt.Sprintf("%s-%d", name, snip.ID)
+	}
+	taken[name] = true
+
+	return name
+}
+
+// exportVSCode writes a VS Code .code-snippets file, which is a JSON object of snippets
+// keyed by name.
+func exportVSCode(snips []*data.Snip) ([]byte, error) {
+	type snippet struct {
+		Prefix      string   `json:"prefix"`
+		Body        []string `json:"body"`
+		Description string   `json:"description,omitempty"`
+	}
+
+	file := make(map[string]snippet, len(snips))
+	taken := make(map[string]bool, len(snips))
+
+	for _, snip := range snips {
+		file[uniqueName(taken, snip.Title, snip)] = snippet{
+			Prefix:      prefix(snip),
+			Body:        strings.Split(body(pieces(snip), "$"), "\n"),
+			Description: snip.Title,
+		}
+	}
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+
+	err := enc.Encode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// exportUltiSnips writes an UltiSnips .snippets file.
+func exportUltiSnips(snips []*data.Snip) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for i, snip := range snips {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		// Descriptions are quoted, and can't contain quotes themselves.
+		description := strings.ReplaceAll(snip.Title, `"`, "'")
+
+		fmt.Fprintf(&buf, "snippet %s \"%s\"\n", prefix(snip), description)
+		buf.WriteString(strings.TrimSuffix(body(pieces(snip), "$`"), "\n"))
+		buf.WriteString("\nendsnippet\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// exportYASnippet writes a zip archive with a yasnippet file for each snip, as yasnippet
+// expects one snippet per file.
+func exportYASnippet(snips []*data.Snip) ([]byte, error) {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	taken := make(map[string]bool, len(snips))
+
+	for _, snip := range snips {
+		f, err := zw.Create(uniqueName(taken, prefix(snip), snip))
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = fmt.Fprintf(f, "# -*- mode: snippet -*-\n# name: %s\n# key: %s\n# --\n%s", snip.Title, prefix(snip), body(pieces(snip), "$`"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// exportJetBrains writes a JetBrains live template set. Live templates refer to their
+// variables by name, as in $name$, and a literal dollar sign is written as $$.
+func exportJetBrains(snips []*data.Snip) ([]byte, error) {
+	type variable struct {
+		Name         string `xml:"name,attr"`
+		Expression   string `xml:"expression,attr"`
+		DefaultValue string `xml:"defaultValue,attr"`
+		AlwaysStopAt bool   `xml:"alwaysStopAt,attr"`
+	}
+
+	type option struct {
+		Name  string `xml:"name,attr"`
+		Value bool   `xml:"value,attr"`
+	}
+
+	type template struct {
+		Name             string     `xml:"name,attr"`
+		Value            string     `xml:"value,attr"`
+		Description      string     `xml:"description,attr"`
+		ToReformat       bool       `xml:"toReformat,attr"`
+		ToShortenFQNames bool       `xml:"toShortenFQNames,attr"`
+		Variables        []variable `xml:"variable"`
+		Context          []option   `xml:"context>option"`
+	}
+
+	set := struct {
+		XMLName   xml.Name   `xml:"templateSet"`
+		Group     string     `xml:"group,attr"`
+		Templates []template `xml:"template"`
+	}{Group: "sniplate"}
+
+	for _, snip := range snips {
+		t := template{
+			Name:             prefix(snip),
+			Description:      snip.Title,
+			ToShortenFQNames: true,
+			Context:          []option{{Name: "OTHER", Value: true}},
+		}
+
+		var value strings.Builder
+
+		for _, p := range pieces(snip) {
+			if p.tabstop == 0 {
+				value.WriteString(strings.ReplaceAll(p.text, "$", "$$"))
+				continue
+			}
+
+			value.WriteString("$" + p.name + "$")
+
+			// Default values are expressions, so plain text has to be quoted.
+			if !p.mirror {
+				t.Variables = append(t.Variables, variable{Name: p.name, DefaultValue: strconv.Quote(p.value), AlwaysStopAt: true})
+			}
+		}
+
+		t.Value = value.String()
+		set.Templates = append(set.Templates, t)
+	}
+
+	out, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
@@ -0,0 +1,331 @@
+package snippets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+)
+
+// FormatTextMate is the TextMate .tmSnippet format, which snips can be imported from.
+const FormatTextMate = "textmate"
+
+// An Entry is a snippet read from a snippet file, converted to a snip which hasn't been
+// validated or saved yet.
+type Entry struct {
+	Name string     // Name of the snippet in the file, for reporting
+	Snip *data.Snip // The title, slug, content, tags and variables of the snippet
+}
+
+// An Importer reads the snippets in a snippet file.
+type Importer func(file []byte) ([]Entry, error)
+
+// Importers holds the importer for each format.
+var Importers = map[string]Importer{
+	FormatVSCode:    importVSCode,
+	FormatUltiSnips: importUltiSnips,
+	FormatTextMate:  importTextMate,
+}
+
+// newEntry converts a snippet to an entry. The trigger becomes the slug of the snip,
+// if it makes a valid one, so that importing the same file again finds the snips which
+// were already imported.
+func newEntry(name, title, trigger, body, escapes string, tags []string) Entry {
+	content, variables := convert(body, escapes)
+
+	if title == "" {
+		title = trigger
+	}
+
+	slug := data.TagRules{Lowercase: true, Slugify: true, MaxLength: 100}.NormalizeTag(trigger)
+	if strings.Trim(slug, "0123456789") == "" {
+		slug = ""
+	}
+
+	return Entry{
+		Name: name,
+		Snip: &data.Snip{
+			Title:     title,
+			Slug:      slug,
+			Content:   content,
+			Tags:      tags,
+			Variables: variables,
+		},
+	}
+}
+
+// scopeTags derives tags from an editor scope, such as "javascript,typescript" in VS
+// Code or "source.go, text.html.basic" in TextMate, which become the language names.
+func scopeTags(scope string) []string {
+	var tags []string
+
+	for _, selector := range strings.FieldsFunc(scope, func(r rune) bool { return r == ',' || r == ' ' }) {
+		selector = strings.TrimPrefix(selector, "source.")
+		selector = strings.TrimPrefix(selector, "text.")
+		language, _, _ := strings.Cut(selector, ".")
+
+		if language != "" && !slices.Contains(tags, language) {
+			tags = append(tags, language)
+		}
+	}
+
+	return tags
+}
+
+// importVSCode reads a VS Code snippets file, which is a JSON object of snippets keyed
+// by name. Like VS Code, it accepts comments and trailing commas.
+func importVSCode(file []byte) ([]Entry, error) {
+	type snippet struct {
+		Prefix      json.RawMessage `json:"prefix"`
+		Body        json.RawMessage `json:"body"`
+		Description string          `json:"description"`
+		Scope       string          `json:"scope"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(stripJSONC(file)))
+
+	// Read the object a member at a time, to keep the snippets in the order of the file.
+	tok, err := dec.Token()
+	if err != nil || tok != json.Delim('{') {
+		return nil, errors.New("file must contain a JSON object of snippets")
+	}
+
+	var entries []Entry
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("file contains badly-formed JSON: %w", err)
+		}
+		name := tok.(string)
+
+		var s snippet
+		err = dec.Decode(&s)
+		if err != nil {
+			return nil, fmt.Errorf("snippet %q is badly-formed: %w", name, err)
+		}
+
+		// The prefix and body may each be a string or an array of strings. A body array
+		// holds the lines of the snippet, and a prefix array alternative triggers, of
+		// which the first is used.
+		prefix, err := stringOrLines(s.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("snippet %q has an invalid prefix", name)
+		}
+		prefix, _, _ = strings.Cut(prefix, "\n")
+
+		body, err := stringOrLines(s.Body)
+		if err != nil {
+			return nil, fmt.Errorf("snippet %q has an invalid body", name)
+		}
+
+		entries = append(entries, newEntry(name, name, prefix, body, "", scopeTags(s.Scope)))
+	}
+
+	return entries, nil
+}
+
+// stringOrLines decodes a JSON string, or an array of strings joined into lines. A
+// missing value is an empty string.
+func stringOrLines(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s, nil
+	}
+
+	var lines []string
+	err := json.Unmarshal(raw, &lines)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// stripJSONC removes // and /* */ comments, and commas before a closing bracket or
+// brace, leaving strings alone.
+func stripJSONC(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+
+	for i := 0; i < len(src); i++ {
+		switch {
+		case src[i] == '"':
+			start := i
+			for i++; i < len(src) && src[i] != '"'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+			out = append(out, src[start:min(i+1, len(src))]...)
+		case src[i] == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			i--
+		case src[i] == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+		case src[i] == ',':
+			j := i + 1
+			for j < len(src) && (src[j] == ' ' || src[j] == '\t' || src[j] == '\n' || src[j] == '\r') {
+				j++
+			}
+			if j < len(src) && (src[j] == '}' || src[j] == ']') {
+				continue
+			}
+			out = append(out, ',')
+		default:
+			out = append(out, src[i])
+		}
+	}
+
+	return out
+}
+
+// importUltiSnips reads an UltiSnips .snippets file. Snippet definitions look like:
+//
+//	snippet trigger "description" options
+//	body
+//	endsnippet
+//
+// Comments and other directives, such as priority and extends, are ignored, as are
+// global blocks of Python code. Snippets with regular expression triggers (the r
+// option) are imported without a slug.
+func importUltiSnips(file []byte) ([]Entry, error) {
+	var (
+		entries []Entry
+		body    []string
+		header  string
+		inside  string // The keyword which closes the current block, if in one
+		line    int
+		start   int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(file))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(file)+1)
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+
+		switch {
+		case inside != "":
+			if strings.TrimRight(text, " \t") != inside {
+				body = append(body, text)
+				continue
+			}
+
+			if inside == "endsnippet" {
+				trigger, description, options := parseUltiSnipsHeader(header)
+				if strings.Contains(options, "r") {
+					trigger = ""
+				}
+
+				name := trigger
+				if name == "" {
+					name = fmt.Sprintf("line %d", start)
+				}
+
+				entries = append(entries, newEntry(name, description, trigger, strings.Join(body, "\n"), "`", nil))
+			}
+			inside, body = "", nil
+
+		case strings.HasPrefix(text, "snippet ") || text == "snippet":
+			header = strings.TrimSpace(strings.TrimPrefix(text, "snippet"))
+			inside, start = "endsnippet", line
+
+		case strings.HasPrefix(text, "global "):
+			inside, start = "endglobal", line
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if inside != "" {
+		return nil, fmt.Errorf("block starting on line %d is missing %s", start, inside)
+	}
+
+	return entries, nil
+}
+
+// parseUltiSnipsHeader splits the rest of a snippet line into the trigger, description
+// and options. Triggers containing spaces are wrapped in a character which doesn't
+// appear in them, usually a quote.
+func parseUltiSnipsHeader(header string) (trigger, description, options string) {
+	if header == "" {
+		return "", "", ""
+	}
+
+	// The closing delimiter has to end a word, so that a trigger such as "(" followed by
+	// a description containing "(" isn't mistaken for a wrapped trigger.
+	end := strings.IndexByte(header[1:], header[0]) + 1
+	if !isLetter(header[0]) && end > 1 && strings.Contains(header[1:end], " ") && (end+1 == len(header) || header[end+1] == ' ') {
+		trigger, header = header[1:end], strings.TrimSpace(header[end+1:])
+	} else {
+		trigger, header, _ = strings.Cut(header, " ")
+		header = strings.TrimSpace(header)
+	}
+
+	if strings.HasPrefix(header, `"`) {
+		if end := strings.LastIndex(header, `"`); end > 0 {
+			description, options = strings.ReplaceAll(header[1:end], `\"`, `"`), strings.TrimSpace(header[end+1:])
+			return trigger, description, options
+		}
+	}
+
+	return trigger, "", header
+}
+
+// importTextMate reads a TextMate .tmSnippet file, which is a property list holding a
+// single snippet.
+func importTextMate(file []byte) ([]Entry, error) {
+	var plist struct {
+		Dict struct {
+			Items []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"dict"`
+	}
+
+	err := xml.Unmarshal(file, &plist)
+	if err != nil {
+		return nil, fmt.Errorf("file must be a property list: %w", err)
+	}
+
+	// A dict alternates between keys and values.
+	fields := make(map[string]string)
+	items := plist.Dict.Items
+
+	for i := 0; i+1 < len(items); i += 2 {
+		if items[i].XMLName.Local == "key" && items[i+1].XMLName.Local == "string" {
+			fields[items[i].Value] = items[i+1].Value
+		}
+	}
+
+	if _, ok := fields["content"]; !ok {
+		return nil, errors.New("file must contain a snippet with content")
+	}
+
+	name := fields["name"]
+	if name == "" {
+		name = fields["tabTrigger"]
+	}
+
+	return []Entry{newEntry(name, fields["name"], fields["tabTrigger"], fields["content"], "", scopeTags(fields["scope"]))}, nil
+}
@@ -0,0 +1,262 @@
+package snippets
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+)
+
+// A part is a piece of a parsed snippet body: literal text, or a reference to a
+// variable.
+type part struct {
+	text     string
+	variable string
+}
+
+// converter parses the TextMate snippet syntax shared by VS Code, UltiSnips and
+// TextMate itself, turning tabstops, placeholders and variables into snip variables.
+// Anything which doesn't parse is kept as literal text, as editors do.
+type converter struct {
+	src     string
+	pos     int
+	escapes string // Characters a backslash escapes, besides $, } and \ itself
+	vars    data.Variables
+}
+
+// convert turns a snippet body into snip content and the variables it uses. Tabstops
+// and placeholders become variables named tabstop1, tabstop2 and so on, with the
+// placeholder text or first choice as their default, and editor variables such as
+// $TM_FILENAME keep their names. The final tabstop, $0, is dropped. Transformations
+// can't be represented, so they simply repeat the variable.
+func convert(body, escapes string) (string, data.Variables) {
+	c := &converter{src: body, escapes: escapes}
+
+	parts := c.parse("")
+
+	// Without variables the content is plain text, so it's kept exactly as it is.
+	if len(c.vars) == 0 {
+		return c.text(parts), nil
+	}
+
+	var b, text strings.Builder
+
+	for _, p := range parts {
+		if p.variable == "" {
+			text.WriteString(p.text)
+			continue
+		}
+
+		b.WriteString(escapeText(text.String(), true))
+		text.Reset()
+
+		b.WriteString("{{." + p.variable + "}}")
+	}
+
+	b.WriteString(escapeText(text.String(), false))
+
+	return b.String(), c.vars
+}
+
+// escapeText escapes literal text for the template language, where "{{" starts an
+// action. When an action follows the text, a trailing "{" would run into it, as in
+// "{{{.tabstop1}}}", so it's escaped as well.
+func escapeText(text string, beforeAction bool) string {
+	text = strings.ReplaceAll(text, "{{", `{{"{{"}}`)
+
+	if beforeAction && strings.HasSuffix(text, "{") {
+		text = strings.TrimSuffix(text, "{") + `{{"{"}}`
+	}
+
+	return text
+}
+
+// text returns the parts as plain text, with variables replaced by their defaults.
+func (c *converter) text(parts []part) string {
+	var b strings.Builder
+
+	for _, p := range parts {
+		if p.variable == "" {
+			b.WriteString(p.text)
+			continue
+		}
+
+		for _, variable := range c.vars {
+			if variable.Name == p.variable && variable.Default != nil {
+				b.WriteString(variable.Default.(string))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// parse reads parts until the end of the body, or until one of the stop characters.
+func (c *converter) parse(stop string) []part {
+	var (
+		parts   []part
+		literal strings.Builder
+	)
+
+	flush := func() {
+		if literal.Len() > 0 {
+			parts = append(parts, part{text: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for c.pos < len(c.src) {
+		ch := c.src[c.pos]
+
+		switch {
+		case ch == '\\' && c.pos+1 < len(c.src) && strings.IndexByte(`\$}`+c.escapes+stop, c.src[c.pos+1]) >= 0:
+			literal.WriteByte(c.src[c.pos+1])
+			c.pos += 2
+		case strings.IndexByte(stop, ch) >= 0:
+			flush()
+			return parts
+		case ch == '$':
+			if p, ok := c.dollar(); ok {
+				flush()
+				if p.variable != "" || p.text != "" {
+					parts = append(parts, p)
+				}
+				continue
+			}
+			literal.WriteByte(ch)
+			c.pos++
+		default:
+			literal.WriteByte(ch)
+			c.pos++
+		}
+	}
+
+	flush()
+	return parts
+}
+
+// dollar parses a tabstop, placeholder, choice or variable starting at a $. If there
+// isn't one, the position is left unchanged and false is returned.
+func (c *converter) dollar() (part, bool) {
+	start := c.pos
+	c.pos++
+
+	braced := c.peek() == '{'
+	if braced {
+		c.pos++
+	}
+
+	name, tabstop := c.name()
+	if name == "" {
+		c.pos = start
+		return part{}, false
+	}
+
+	if !braced {
+		return c.use(name, tabstop, "", false), true
+	}
+
+	switch c.peek() {
+	case '}':
+		c.pos++
+		return c.use(name, tabstop, "", false), true
+	case ':':
+		c.pos++
+		value := c.text(c.parse("}"))
+		if c.peek() == '}' {
+			c.pos++
+			return c.use(name, tabstop, value, true), true
+		}
+	case '|':
+		c.pos++
+		choices := c.parse("|")
+		if c.peek() == '|' && c.pos+1 < len(c.src) && c.src[c.pos+1] == '}' {
+			c.pos += 2
+			first, _, _ := strings.Cut(c.text(choices), ",")
+			return c.use(name, tabstop, first, true), true
+		}
+	case '/':
+		// A transformation is /regex/format/options}, which is skipped. The format may
+		// contain braced references of its own, such as ${1:/upcase}.
+		for slashes, depth := 0, 0; c.pos < len(c.src); c.pos++ {
+			switch ch := c.src[c.pos]; {
+			case ch == '\\':
+				c.pos++
+			case ch == '/' && depth == 0:
+				slashes++
+			case ch == '{':
+				depth++
+			case ch == '}' && depth > 0:
+				depth--
+			case ch == '}' && slashes >= 3:
+				c.pos++
+				return c.use(name, tabstop, "", false), true
+			}
+		}
+	}
+
+	c.pos = start
+	return part{}, false
+}
+
+// name reads a tabstop number or a variable name. For tabstops the second return
+// value is true.
+func (c *converter) name() (string, bool) {
+	start := c.pos
+
+	for c.pos < len(c.src) && c.src[c.pos] >= '0' && c.src[c.pos] <= '9' {
+		c.pos++
+	}
+	if c.pos > start {
+		return c.src[start:c.pos], true
+	}
+
+	for c.pos < len(c.src) && (c.src[c.pos] == '_' || isLetter(c.src[c.pos]) || (c.pos > start && c.src[c.pos] >= '0' && c.src[c.pos] <= '9')) {
+		c.pos++
+	}
+
+	return c.src[start:c.pos], false
+}
+
+// use declares the variable for a tabstop or editor variable the first time it is seen,
+// and returns the part which refers to it. The final tabstop becomes its default text,
+// if it has any.
+func (c *converter) use(name string, tabstop bool, value string, hasValue bool) part {
+	if tabstop {
+		n, _ := strconv.Atoi(name)
+		if n == 0 {
+			return part{text: value}
+		}
+		name = "tabstop" + strconv.Itoa(n)
+	}
+
+	i := -1
+	for j, variable := range c.vars {
+		if variable.Name == name {
+			i = j
+		}
+	}
+
+	if i < 0 {
+		c.vars = append(c.vars, data.Variable{Name: name, Type: data.VariableString})
+		i = len(c.vars) - 1
+	}
+
+	// The first placeholder text for a tabstop is its default, wherever it appears.
+	if hasValue && value != "" && c.vars[i].Default == nil {
+		c.vars[i].Default = value
+	}
+
+	return part{variable: name}
+}
+
+func (c *converter) peek() byte {
+	if c.pos < len(c.src) {
+		return c.src[c.pos]
+	}
+	return 0
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
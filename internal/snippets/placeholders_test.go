@@ -0,0 +1,96 @@
+package snippets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pwilliams-ck/sniplate/internal/render"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		content string
+		output  string
+	}{
+		{
+			name:    "plain text",
+			body:    "func main() {}",
+			content: "func main() {}",
+			output:  "func main() {}",
+		},
+		{
+			name:    "placeholder",
+			body:    "Hello ${1:world}",
+			content: "Hello {{.tabstop1}}",
+			output:  "Hello world",
+		},
+		{
+			name:    "brace before placeholder",
+			body:    "T{${1:x}}",
+			content: `T{{"{"}}{{.tabstop1}}}`,
+			output:  "T{x}",
+		},
+		{
+			name:    "composite literal",
+			body:    "map[string]int{$1}",
+			content: `map[string]int{{"{"}}{{.tabstop1}}}`,
+			output:  "map[string]int{}",
+		},
+		{
+			name:    "double brace before placeholder",
+			body:    "{{$1}}",
+			content: `{{"{{"}}{{.tabstop1}}}}`,
+			output:  "{{}}",
+		},
+		{
+			name:    "triple brace before placeholder",
+			body:    "{{{$1",
+			content: `{{"{{"}}{{"{"}}{{.tabstop1}}`,
+			output:  "{{{",
+		},
+		{
+			name:    "brace split by final tabstop",
+			body:    "x{$0{${1:y}",
+			content: `x{{"{{"}}{{.tabstop1}}`,
+			output:  "x{{y",
+		},
+		{
+			name:    "braces with a later placeholder",
+			body:    "{{ x }} $1",
+			content: `{{"{{"}} x }} {{.tabstop1}}`,
+			output:  "{{ x }} ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, variables := convert(tt.body, "")
+			if content != tt.content {
+				t.Fatalf("got content %q; want %q", content, tt.content)
+			}
+
+			tmpl, err := render.Parse("test", content, nil)
+			if err != nil {
+				t.Fatalf("content doesn't parse: %v", err)
+			}
+
+			values := make(map[string]any, len(variables))
+			for _, variable := range variables {
+				values[variable.Name] = variable.Default
+				if variable.Default == nil {
+					values[variable.Name] = ""
+				}
+			}
+
+			output, err := render.Execute(tmpl, values, render.Limits{MaxOutput: 1 << 10, Timeout: time.Second})
+			if err != nil {
+				t.Fatalf("content doesn't render: %v", err)
+			}
+			if output != tt.output {
+				t.Errorf("got output %q; want %q", output, tt.output)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Package snippets converts snips to and from the snippet files used by code editors.
+// Variables declared by a snip become the tabstops, or placeholders, of the editor
+// snippet.
+package snippets
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pwilliams-ck/sniplate/internal/data"
+	"github.com/pwilliams-ck/sniplate/internal/render"
+)
+
+// The snippet formats snips can be exported to.
+const (
+	FormatVSCode    = "vscode"
+	FormatUltiSnips = "ultisnips"
+	FormatYASnippet = "yasnippet"
+	FormatJetBrains = "jetbrains"
+)
+
+// An Exporter writes snips in the snippet format of an editor.
+type Exporter struct {
+	ContentType string                                   // Media type of the exported file
+	Filename    string                                   // Suggested name for the exported file
+	Export      func(snips []*data.Snip) ([]byte, error) // Converts the snips
+}
+
+// Exporters holds the exporter for each format.
+var Exporters = map[string]Exporter{
+	FormatVSCode:    {ContentType: "application/json", Filename: "sniplate.code-snippets", Export: exportVSCode},
+	FormatUltiSnips: {ContentType: "text/plain; charset=utf-8", Filename: "sniplate.snippets", Export: exportUltiSnips},
+	FormatYASnippet: {ContentType: "application/zip", Filename: "sniplate-yasnippet.zip", Export: exportYASnippet},
+	FormatJetBrains: {ContentType: "application/xml", Filename: "sniplate.xml", Export: exportJetBrains},
+}
+
+// A piece is part of the body of a snippet: literal text, or a tabstop for a variable.
+type piece struct {
+	text    string
+	tabstop int    // Tabstop number, counting from 1, or 0 for text
+	name    string // Variable name, for tabstops
+	value   string // Default text of the tabstop
+	mirror  bool   // Whether the variable has already appeared earlier in the body
+}
+
+// pieces splits the content of a snip into text and tabstops. Tabstops are numbered in
+// the order the variables first appear in the content, and later appearances mirror
+// the first. Snips without variables are plain text. Escapes such as {{"{{"}} become
+// the text they stand for, and any other action, such as an if or an include, is
+// dropped, as editors have no way to run it.
+func pieces(snip *data.Snip) []piece {
+	if len(snip.Variables) == 0 {
+		return []piece{{text: snip.Content}}
+	}
+
+	tmpl, err := render.Parse("content", snip.Content, nil)
+	if err != nil {
+		return []piece{{text: snip.Content}}
+	}
+
+	var (
+		result []piece
+		seen   []string
+	)
+
+	for _, segment := range render.Segments(tmpl) {
+		if segment.Action != "" {
+			continue
+		}
+
+		i := slices.IndexFunc(snip.Variables, func(variable data.Variable) bool { return variable.Name == segment.Variable })
+		if segment.Variable == "" || i < 0 {
+			result = append(result, piece{text: segment.Text})
+			continue
+		}
+
+		variable := snip.Variables[i]
+
+		value := variable.Name
+		if variable.Default != nil {
+			value = fmt.Sprint(variable.Default)
+		}
+
+		mirror := slices.Contains(seen, variable.Name)
+		if !mirror {
+			seen = append(seen, variable.Name)
+		}
+
+		result = append(result, piece{
+			tabstop: slices.Index(seen, variable.Name) + 1,
+			name:    variable.Name,
+			value:   value,
+			mirror:  mirror,
+		})
+	}
+
+	return result
+}
+
+// prefix returns the trigger word for a snip: its slug, or its title in slug form.
+func prefix(snip *data.Snip) string {
+	if snip.Slug != "" {
+		return snip.Slug
+	}
+
+	p := data.TagRules{Lowercase: true, Slugify: true}.NormalizeTag(snip.Title)
+	if p == "" {
+		p = fmt.Sprintf("snip-%d", snip.ID)
+	}
+
+	return p
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS snips_owner_id_idx;
+
+ALTER TABLE snips DROP COLUMN IF EXISTS owner_id;
@@ -0,0 +1,3 @@
+ALTER TABLE snips ADD COLUMN IF NOT EXISTS owner_id bigint REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS snips_owner_id_idx ON snips (owner_id);
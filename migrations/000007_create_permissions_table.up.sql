@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+-- Add the permission codes used by the snip endpoints. Holders of snips:admin may
+-- modify snips owned by other users.
+INSERT INTO permissions (code)
+VALUES
+    ('snips:read'),
+    ('snips:write'),
+    ('snips:admin')
+ON CONFLICT (code) DO NOTHING;
@@ -0,0 +1,12 @@
+-- Holders of users:admin may grant and revoke permissions for other users.
+INSERT INTO permissions (code)
+VALUES ('users:admin')
+ON CONFLICT (code) DO NOTHING;
+
+-- New users are given snips:read when they register, so backfill it for everybody who
+-- registered before that default existed.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users, permissions
+WHERE permissions.code = 'snips:read'
+ON CONFLICT DO NOTHING;
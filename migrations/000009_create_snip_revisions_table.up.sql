@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS snip_revisions (
+    snip_id bigint NOT NULL REFERENCES snips ON DELETE CASCADE,
+    version integer NOT NULL,
+    replaced_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    content text NOT NULL,
+    tags text[] NOT NULL,
+    PRIMARY KEY (snip_id, version)
+);
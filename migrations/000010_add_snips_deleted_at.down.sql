@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS snips_deleted_at_idx;
+
+-- Trashed snips would reappear once the column is gone, so remove them for good.
+DELETE FROM snips WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE snips DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE snips ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS snips_deleted_at_idx ON snips (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS snips_search_idx;
+DROP TRIGGER IF EXISTS snips_search_update ON snips;
+DROP FUNCTION IF EXISTS snips_search_update();
+ALTER TABLE snips DROP COLUMN IF EXISTS search;
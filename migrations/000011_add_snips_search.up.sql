@@ -0,0 +1,24 @@
+ALTER TABLE snips ADD COLUMN IF NOT EXISTS search tsvector;
+
+-- array_to_string() isn't immutable, so the search vector can't be a generated column
+-- and is kept up to date by a trigger instead. Titles rank highest, then tags, then
+-- content.
+CREATE OR REPLACE FUNCTION snips_search_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search :=
+        setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(array_to_string(NEW.tags, ' '), '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.content, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS snips_search_update ON snips;
+CREATE TRIGGER snips_search_update
+    BEFORE INSERT OR UPDATE OF title, content, tags ON snips
+    FOR EACH ROW EXECUTE FUNCTION snips_search_update();
+
+-- Fire the trigger once for every existing snip to fill in the new column.
+UPDATE snips SET title = title;
+
+CREATE INDEX IF NOT EXISTS snips_search_idx ON snips USING GIN (search);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS snips_title_trgm_idx;
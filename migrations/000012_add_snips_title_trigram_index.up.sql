@@ -0,0 +1,3 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS snips_title_trgm_idx ON snips USING GIN (title gin_trgm_ops);
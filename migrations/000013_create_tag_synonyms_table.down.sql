@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS tag_synonym_group(text);
+DROP TABLE IF EXISTS tag_synonyms;
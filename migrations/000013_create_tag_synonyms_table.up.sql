@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS tag_synonyms (
+    synonym text PRIMARY KEY,
+    tag text NOT NULL,
+    CONSTRAINT tag_synonyms_distinct_check CHECK (synonym <> tag)
+);
+
+CREATE INDEX IF NOT EXISTS tag_synonyms_tag_idx ON tag_synonyms (tag);
+
+-- tag_synonym_group() returns a tag along with every tag which means the same thing: its
+-- canonical tag, if it is a synonym, and all of the synonyms of that canonical tag.
+-- Searches match snips which have any tag in the group.
+CREATE OR REPLACE FUNCTION tag_synonym_group(t text) RETURNS text[] AS $$
+    WITH canonical AS (
+        SELECT COALESCE((SELECT tag FROM tag_synonyms WHERE synonym = t), t) AS tag
+    )
+    SELECT array_agg(tag) FROM (
+        SELECT tag FROM canonical
+        UNION
+        SELECT synonym FROM tag_synonyms WHERE tag = (SELECT tag FROM canonical)
+        UNION
+        SELECT t
+    ) AS grouped
+$$ LANGUAGE sql STABLE;
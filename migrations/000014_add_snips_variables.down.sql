@@ -0,0 +1,2 @@
+ALTER TABLE snip_revisions DROP COLUMN IF EXISTS variables;
+ALTER TABLE snips DROP COLUMN IF EXISTS variables;
@@ -0,0 +1,2 @@
+ALTER TABLE snips ADD COLUMN IF NOT EXISTS variables jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE snip_revisions ADD COLUMN IF NOT EXISTS variables jsonb NOT NULL DEFAULT '[]';
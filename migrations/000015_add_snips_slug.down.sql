@@ -0,0 +1,2 @@
+ALTER TABLE snips DROP CONSTRAINT IF EXISTS snips_slug_key;
+ALTER TABLE snips DROP COLUMN IF EXISTS slug;
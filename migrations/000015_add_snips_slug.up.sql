@@ -0,0 +1,2 @@
+ALTER TABLE snips ADD COLUMN IF NOT EXISTS slug text;
+ALTER TABLE snips ADD CONSTRAINT snips_slug_key UNIQUE (slug);
@@ -0,0 +1,3 @@
+-- The original tags are kept as revisions, but later edits may have been made on top
+-- of the normalized ones, so normalizing them isn't undone here.
+SELECT 1;
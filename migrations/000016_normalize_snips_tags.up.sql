@@ -0,0 +1,32 @@
+-- Normalize the tags of existing snips with the default tag rules (-tags-trim,
+-- -tags-lowercase and -tags-max-length=50), which are only applied when a snip is saved,
+-- so that searches, which are normalized too, still find them. Tags which become
+-- duplicates are merged, keeping the position of the first, and tags which become empty
+-- are dropped, as they would no longer pass validation. Each snip which changes is
+-- archived as a revision and gets a new version, just as if it had been edited, so
+-- clients holding the old version get an edit conflict rather than overwriting it.
+WITH normalized AS (
+    SELECT snips.id, COALESCE((
+        SELECT array_agg(tag ORDER BY position)
+        FROM (
+            SELECT left(lower(btrim(t.tag, E' \t\n\r\f\v')), 50) AS tag, min(t.position) AS position
+            FROM unnest(snips.tags) WITH ORDINALITY AS t(tag, position)
+            GROUP BY 1
+        ) AS deduplicated
+        WHERE tag <> ''
+    ), '{}') AS tags
+    FROM snips
+), changed AS (
+    SELECT normalized.id, normalized.tags
+    FROM normalized
+    JOIN snips ON snips.id = normalized.id
+    WHERE snips.tags IS DISTINCT FROM normalized.tags
+), archived AS (
+    INSERT INTO snip_revisions (snip_id, version, title, content, tags, variables)
+    SELECT snips.id, snips.version, snips.title, snips.content, snips.tags, snips.variables
+    FROM snips
+    JOIN changed ON changed.id = snips.id
+)
+UPDATE snips SET tags = changed.tags, version = snips.version + 1
+FROM changed
+WHERE snips.id = changed.id;